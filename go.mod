@@ -3,13 +3,13 @@ module github.com/dogeorg/dogetracker
 go 1.18
 
 require (
+	github.com/btcsuite/golangcrypto v0.0.0-20150304025918-53f62d9b43e8
 	github.com/dogeorg/doge v0.0.12
 	github.com/lib/pq v1.10.9
 	github.com/pebbe/zmq4 v1.2.9
 )
 
 require (
-	github.com/btcsuite/golangcrypto v0.0.0-20150304025918-53f62d9b43e8 // indirect
 	github.com/decred/dcrd/crypto/blake256 v1.1.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.3.0 // indirect
 	github.com/mr-tron/base58 v1.2.0 // indirect
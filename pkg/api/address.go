@@ -0,0 +1,267 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+// handleAddressRoutes routes /api/address/{addr} and its sub-resources
+func (s *Server) handleAddressRoutes(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r, "/api/address/")
+	if len(parts) == 1 {
+		s.handleGetAddress(w, r, parts[0])
+		return
+	}
+
+	// Rescans are admin only, every other sub-resource takes the API token
+	if len(parts) == 2 && parts[1] == "rescan" {
+		if !s.authenticateAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	} else if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	address, ok := normalizeAddress(parts[0])
+	if !ok {
+		http.Error(w, "Invalid address", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "wait":
+		s.handleWait(w, r, address)
+	case len(parts) == 2 && parts[1] == "history":
+		s.handleHistory(w, r, address)
+	case len(parts) == 2 && parts[1] == "changes":
+		s.handleChanges(w, r, address)
+	case len(parts) == 2 && parts[1] == "utxo-count":
+		s.handleUTXOCount(w, r, address)
+	case len(parts) == 2 && parts[1] == "volume":
+		s.handleVolume(w, r, address)
+	case len(parts) == 2 && parts[1] == "activity":
+		s.handleActivity(w, r, address)
+	case len(parts) == 2 && parts[1] == "proof":
+		s.handleProof(w, r, address)
+	case len(parts) == 2 && parts[1] == "dropped":
+		s.handleDropped(w, r, address)
+	case len(parts) == 2 && parts[1] == "rescan":
+		s.handleRescan(w, r, address)
+	case len(parts) == 2 && parts[1] == "select":
+		s.handleSelect(w, r, address)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+var historyIntervals = map[string]bool{"hour": true, "day": true, "week": true, "month": true}
+
+// handleHistory returns an address's balance time series.
+// GET /api/address/{addr}/history?interval=day
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if !historyIntervals[interval] {
+		http.Error(w, "Invalid interval (use hour, day, week or month)", http.StatusBadRequest)
+		return
+	}
+
+	history, err := s.readDB(w).GetBalanceHistory(address, interval)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []database.BalanceSnapshot{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"address":  address,
+		"interval": interval,
+		"history":  history,
+	})
+}
+
+// handleUTXOCount returns an address's current unspent output count and its
+// time series, to plan consolidations before spends get expensive.
+// GET /api/address/{addr}/utxo-count?interval=day
+func (s *Server) handleUTXOCount(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if !historyIntervals[interval] {
+		http.Error(w, "Invalid interval (use hour, day, week or month)", http.StatusBadRequest)
+		return
+	}
+
+	history, err := s.readDB(w).GetUTXOCountHistory(address, interval)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []database.UTXOCountSnapshot{}
+	}
+
+	// Growth over the series: latest count minus the first one
+	var current, growth int
+	if len(history) > 0 {
+		current = history[len(history)-1].UTXOCount
+		growth = current - history[0].UTXOCount
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"address":    address,
+		"interval":   interval,
+		"utxo_count": current,
+		"growth":     growth,
+		"history":    history,
+	})
+}
+
+// handleDropped lists transactions removed from an address's history, and why.
+// GET /api/address/{addr}/dropped
+func (s *Server) handleDropped(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropped, err := s.readDB(w).GetDroppedTransactions(address)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if dropped == nil {
+		dropped = []database.DroppedTransaction{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"address": address,
+		"dropped": dropped,
+	})
+}
+
+// volumeWindows maps the supported ?window= values to Postgres intervals
+var volumeWindows = map[string]string{
+	"1h":  "1 hour",
+	"24h": "24 hours",
+	"7d":  "7 days",
+	"30d": "30 days",
+}
+
+// handleVolume returns an address's incoming and outgoing totals over a
+// rolling window.
+// GET /api/address/{addr}/volume?window=24h
+func (s *Server) handleVolume(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "24h"
+	}
+	interval, ok := volumeWindows[window]
+	if !ok {
+		http.Error(w, "Invalid window (use 1h, 24h, 7d or 30d)", http.StatusBadRequest)
+		return
+	}
+
+	volume, err := s.readDB(w).GetAddressVolume(address, interval)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"address":        address,
+		"window":         window,
+		"incoming":       volume.Incoming,
+		"incoming_count": volume.IncomingCount,
+		"outgoing":       volume.Outgoing,
+		"outgoing_count": volume.OutgoingCount,
+	})
+}
+
+// handleActivity returns an address's first and last received transactions,
+// for cheap account-age and recency checks.
+// GET /api/address/{addr}/activity
+func (s *Server) handleActivity(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	first, last, found, err := s.readDB(w).GetAddressActivity(address)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"address": address,
+		"first":   first,
+		"last":    last,
+	})
+}
+
+const maxChanges = 1000 // most changes per /changes response
+
+// handleChanges returns what changed for an address after a cursor, for
+// clients keeping a local mirror in sync: pass the returned cursor as
+// since on the next call.
+// GET /api/address/{addr}/changes?since=N
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+
+	changes, cursor, found, err := s.readDB(w).GetAddressChanges(address, since, maxChanges)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+	if changes == nil {
+		changes = []database.AddressChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"address": address,
+		"since":   since,
+		"cursor":  cursor,
+		"more":    len(changes) == maxChanges,
+		"changes": changes,
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+// SetAmountsAsStrings makes JSON responses carry DOGE amounts as decimal
+// strings with 8 places ("123.45678901") instead of numbers, for clients
+// that would lose precision parsing them as 64-bit floats.
+func (s *Server) SetAmountsAsStrings(enabled bool) {
+	s.amountsAsStrings = enabled
+}
+
+// Units for ?unit=
+const (
+	UnitDoge    = "doge"    // decimal DOGE (default)
+	UnitSatoshi = "satoshi" // integer satoshis
+)
+
+// parseUnit parses the optional ?unit= parameter
+func parseUnit(value string) (string, bool) {
+	switch value {
+	case "", UnitDoge:
+		return UnitDoge, true
+	case UnitSatoshi:
+		return UnitSatoshi, true
+	}
+	return "", false
+}
+
+// amountFormat returns how the request wants DOGE amounts written, or nil
+// for JSON numbers.
+func (s *Server) amountFormat(r *http.Request) func(spec.Amount) interface{} {
+	unit, _ := parseUnit(r.URL.Query().Get("unit"))
+	// Integer satoshis are exact, so they win over amounts as strings
+	if unit == UnitSatoshi {
+		return func(a spec.Amount) interface{} { return json.Number(strconv.FormatInt(int64(a), 10)) }
+	}
+	if s.amountsAsStrings {
+		return func(a spec.Amount) interface{} { return a.String() }
+	}
+	return nil
+}
+
+// writeJSON encodes a handler's response. spec.Amount values are written
+// in the request's amount format.
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	format := s.amountFormat(r)
+	if format == nil {
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(formatAmounts(reflect.ValueOf(v), tree, format))
+}
+
+var amountType = reflect.TypeOf(spec.Amount(0))
+
+// formatAmounts walks v alongside tree, its decoded JSON, and replaces the
+// values encoded from spec.Amount with format's result.
+func formatAmounts(v reflect.Value, tree interface{}, format func(spec.Amount) interface{}) interface{} {
+	if !v.IsValid() {
+		return tree
+	}
+	if v.Type() == amountType {
+		return format(spec.Amount(v.Int()))
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return tree
+		}
+		return formatAmounts(v.Elem(), tree, format)
+	case reflect.Struct:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return tree // encoded by its own MarshalJSON, like time.Time
+		}
+		formatFields(v, obj, format)
+	case reflect.Slice, reflect.Array:
+		arr, ok := tree.([]interface{})
+		if !ok {
+			return tree
+		}
+		for i := range arr {
+			if i < v.Len() {
+				arr[i] = formatAmounts(v.Index(i), arr[i], format)
+			}
+		}
+	case reflect.Map:
+		obj, ok := tree.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return tree
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if val, ok := obj[key]; ok {
+				obj[key] = formatAmounts(iter.Value(), val, format)
+			}
+		}
+	}
+	return tree
+}
+
+// formatFields formats the amounts in a struct's fields, found in obj by
+// their JSON names. Embedded structs' fields are in obj too.
+func formatFields(v reflect.Value, obj map[string]interface{}, format func(spec.Amount) interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				formatFields(embedded, obj, format)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if val, ok := obj[name]; ok {
+			obj[name] = formatAmounts(v.Field(i), val, format)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+func TestWriteJSONAmountsAsStrings(t *testing.T) {
+	balance := spec.Amount(30000000)
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{
+			"struct fields",
+			UnspentOutput{TxHash: "a1", Amount: 12345678901, BlockHeight: 7},
+			`"amount":"123.45678901"`,
+		},
+		{
+			"pointer to an amount",
+			BalanceResponse{Address: "D1", Tracked: true, Balance: &balance},
+			`"balance":"0.30000000"`,
+		},
+		{
+			"slices and maps",
+			map[string]interface{}{"transactions": []database.ActivityTransaction{{TxHash: "a1", Amount: 1}}},
+			`"amount":"0.00000001"`,
+		},
+		{
+			"signed amounts",
+			database.BlockAddress{Address: "D1", Received: 0, Sent: 5 * spec.KoinuPerDoge, Net: -5 * spec.KoinuPerDoge},
+			`"net":"-5.00000000"`,
+		},
+		{
+			// Only spec.Amount values are amounts, whatever the field is called
+			"other numbers",
+			map[string]interface{}{"total": 3, "amount": spec.Amount(2)},
+			`{"amount":"0.00000002","total":3}`,
+		},
+	}
+	s := &Server{amountsAsStrings: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.writeJSON(w, httptest.NewRequest("GET", "/api/address/D1", nil), tt.v)
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("writeJSON() = %s, want it to contain %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONAmountsAsNumbers(t *testing.T) {
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.writeJSON(w, httptest.NewRequest("GET", "/api/address/D1", nil), Transaction{
+		TxHash:    "a1",
+		Amount:    30000000,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	for _, want := range []string{`"amount":0.3,`, `"created_at":"2024-01-02T03:04:05Z"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("writeJSON() = %s, want it to contain %s", w.Body.String(), want)
+		}
+	}
+}
+
+func TestWriteJSONSatoshis(t *testing.T) {
+	tests := []struct {
+		name             string
+		amountsAsStrings bool
+		v                interface{}
+		want             string
+	}{
+		{"exact decimal", false, UnspentOutput{Amount: 30000000}, `"amount":30000000,`},
+		{"beyond float precision", false, UnspentOutput{Amount: 100000000000000001}, `"amount":100000000000000001,`},
+		{"negative", false, database.BlockAddress{Net: -1}, `"net":-1`},
+		{"wins over strings", true, UnspentOutput{Amount: 12345678901}, `"amount":12345678901,`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{amountsAsStrings: tt.amountsAsStrings}
+			w := httptest.NewRecorder()
+			s.writeJSON(w, httptest.NewRequest("GET", "/api/address/D1?unit=satoshi", nil), tt.v)
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("writeJSON() = %s, want it to contain %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+// maxBalanceAddresses caps the addresses in one POST /api/balances request
+const maxBalanceAddresses = 1000
+
+// BalancesRequest is the body of POST /api/balances
+type BalancesRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// BalanceResponse is one address's entry in the POST /api/balances response.
+// The amounts are only present for tracked addresses.
+type BalanceResponse struct {
+	Address   string       `json:"address"`
+	Tracked   bool         `json:"tracked"`
+	Error     string       `json:"error,omitempty"`
+	Confirmed *spec.Amount `json:"confirmed,omitempty"`
+	Pending   *spec.Amount `json:"pending,omitempty"`
+	Balance   *spec.Amount `json:"balance,omitempty"`
+}
+
+// handleBalances returns the balances of many addresses in one query, with
+// an entry for every requested address in request order.
+// POST /api/balances {"addresses": [...]}
+func (s *Server) handleBalances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req BalancesRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.Addresses) == 0 {
+		http.Error(w, "No addresses given", http.StatusBadRequest)
+		return
+	}
+	if len(req.Addresses) > maxBalanceAddresses {
+		http.Error(w, fmt.Sprintf("Too many addresses (max %d)", maxBalanceAddresses), http.StatusBadRequest)
+		return
+	}
+
+	response := make([]BalanceResponse, len(req.Addresses))
+	var valid []string
+	for i, addr := range req.Addresses {
+		response[i].Address = addr
+		if normalized, ok := normalizeAddress(addr); ok {
+			response[i].Address = normalized
+			valid = append(valid, normalized)
+		} else {
+			response[i].Error = "Invalid address"
+		}
+	}
+
+	balances, err := s.readDB(w).GetBalances(valid)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range response {
+		if b, ok := balances[response[i].Address]; ok && response[i].Error == "" {
+			response[i].Tracked = true
+			response[i].Confirmed = &b.Confirmed
+			response[i].Pending = &b.Pending
+			response[i].Balance = &b.Balance
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, response)
+}
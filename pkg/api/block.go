@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+// BlockReprocessor is implemented by the block processor so the API can
+// repair a single processed block.
+type BlockReprocessor interface {
+	// Reprocess deletes what is recorded for the block and walks it again
+	// for every tracked address.
+	Reprocess(hash string) (ReprocessReport, error)
+}
+
+// ReprocessReport is what reprocessing a block changed
+type ReprocessReport struct {
+	Hash    string                  `json:"hash"`
+	Height  int64                   `json:"height"`
+	Added   int                     `json:"added"`   // transactions not recorded before
+	Removed int                     `json:"removed"` // transactions not found again
+	Before  []database.BlockAddress `json:"before"`  // what each address received and spent
+	After   []database.BlockAddress `json:"after"`
+}
+
+// SetBlockReprocessor enables POST /api/block/{hash}/reprocess.
+func (s *Server) SetBlockReprocessor(reprocessor BlockReprocessor) {
+	s.reprocessor = reprocessor
+}
+
+// handleBlock routes /api/block/{hash}/... sub-resources
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	// Split "{hash}/{resource}"; block hashes have the same form as txids
+	parts := pathParts(r, "/api/block/")
+
+	// Reprocessing is admin only, every other sub-resource takes the API token
+	if len(parts) == 2 && parts[1] == "reprocess" {
+		if !s.authenticateAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	} else if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hash := strings.ToLower(parts[0])
+	if !isValidTxID(hash) {
+		http.Error(w, "Invalid block hash", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "addresses":
+		s.handleBlockAddresses(w, r, hash)
+	case len(parts) == 2 && parts[1] == "reprocess":
+		s.handleReprocess(w, r, hash)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleBlockAddresses returns the tracked addresses a block touched and
+// their net amounts
+func (s *Server) handleBlockAddresses(w http.ResponseWriter, r *http.Request, hash string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	block, err := s.readDB(w).GetBlockAddresses(hash)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if block == nil {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, block)
+}
+
+// handleReprocess deletes what is recorded for a processed block and
+// processes it again, reporting what changed (admin only).
+// POST /api/block/{hash}/reprocess
+func (s *Server) handleReprocess(w http.ResponseWriter, r *http.Request, hash string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.reprocessor == nil {
+		http.Error(w, "Block processor not available", http.StatusServiceUnavailable)
+		return
+	}
+	if s.rejectWrite(w) {
+		return
+	}
+
+	log.Printf("API: reprocessing block %s (token=%s)", hash, tokenID(r))
+	report, err := s.reprocessor.Reprocess(hash)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reprocessing block: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, report)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/dogeorg/dogetracker/pkg/version"
+)
+
+// Capabilities describes what the running instance supports, so clients
+// can adapt to how it is configured
+type Capabilities struct {
+	Version  version.Info    `json:"version"`
+	Network  string          `json:"network"` // chain whose addresses are accepted
+	Features map[string]bool `json:"features"`
+	Units    []string        `json:"units"`     // accepted ?unit= values
+	JSONCase string          `json:"json_case"` // "snake" or "camel"
+	Limits   Limits          `json:"limits"`
+}
+
+// Limits are the request limits of the running instance
+type Limits struct {
+	MaxAddresses        int   `json:"max_addresses"` // 0 means unlimited
+	MaxBodyBytes        int64 `json:"max_body_bytes"`
+	MaxBalanceAddresses int   `json:"max_balance_addresses"` // per POST /api/balances
+	MaxChanges          int   `json:"max_changes"`           // per /changes response
+	MaxPageSize         int   `json:"max_page_size"`         // ?limit= of transaction pages
+	MaxReplayDays       int   `json:"max_replay_days"`
+	MaxReplayEvents     int   `json:"max_replay_events"`
+	MaxNoteLength       int   `json:"max_note_length"`
+	MaxWaitSeconds      int   `json:"max_wait_seconds"`
+}
+
+// handleCapabilities reports the optional features enabled on this
+// instance and its limits
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	jsonCase := "snake"
+	if s.jsonCase == CamelCase {
+		jsonCase = "camel"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, Capabilities{
+		Version: version.Get(),
+		Network: chain.ChainName,
+		Features: map[string]bool{
+			"webhooks":        s.webhook != nil,
+			"admin":           s.adminToken != "",
+			"rescan":          s.rescanner != nil && s.adminToken != "",
+			"reprocess":       s.reprocessor != nil && s.adminToken != "",
+			"cursor_rewind":   s.cursor != nil && s.adminToken != "",
+			"merkle_proofs":   s.prover != nil,
+			"read_replica":    s.replica != nil,
+			"leader_election": s.leader != nil,
+			"string_amounts":  s.amountsAsStrings,
+		},
+		Units:    []string{UnitDoge, UnitSatoshi},
+		JSONCase: jsonCase,
+		Limits: Limits{
+			MaxAddresses:        s.maxAddresses,
+			MaxBodyBytes:        s.maxBody,
+			MaxBalanceAddresses: maxBalanceAddresses,
+			MaxChanges:          maxChanges,
+			MaxPageSize:         maxPageSize,
+			MaxReplayDays:       maxReplayDays,
+			MaxReplayEvents:     maxReplayEvents,
+			MaxNoteLength:       maxNoteLength,
+			MaxWaitSeconds:      int(maxWait.Seconds()),
+		},
+	})
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/dogeorg/dogetracker/pkg/coinselect"
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+const defaultStrategy = "largest-first"
+
+type SelectedInput struct {
+	TxHash string      `json:"tx_hash"`
+	Vout   *int        `json:"vout"` // null if recorded before output indexes were stored
+	Amount spec.Amount `json:"amount"`
+}
+
+type SelectionResponse struct {
+	Strategy string          `json:"strategy"`
+	Target   spec.Amount     `json:"target"`
+	Inputs   []SelectedInput `json:"inputs"`
+	Total    spec.Amount     `json:"total"`
+	Change   spec.Amount     `json:"change"`
+}
+
+func toKoinu(amount float64) int64 {
+	return int64(math.Round(amount * coinselect.KoinuPerDoge))
+}
+
+// parseTarget parses the amount to select for, in DOGE, into koinu. It
+// must be positive, finite and at most coinselect.MaxMoney.
+func parseTarget(s string) (int64, bool) {
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) || amount <= 0 {
+		return 0, false
+	}
+	// Compared as a float first so the conversion to koinu cannot overflow
+	if amount > 2*coinselect.MaxMoney/coinselect.KoinuPerDoge {
+		return 0, false
+	}
+	target := toKoinu(amount)
+	if target <= 0 || target > coinselect.MaxMoney {
+		return 0, false
+	}
+	return target, true
+}
+
+// handleSelect suggests which unspent outputs to spend for an amount.
+// GET /api/address/{addr}/select?amount=100.5&strategy=largest-first|bnb[&exclude_dust=true]
+func (s *Server) handleSelect(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	target, ok := parseTarget(query.Get("amount"))
+	if !ok {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+	name := query.Get("strategy")
+	if name == "" {
+		name = defaultStrategy
+	}
+	strategy, ok := coinselect.Strategies[name]
+	if !ok {
+		http.Error(w, "Unknown strategy (use largest-first or bnb)", http.StatusBadRequest)
+		return
+	}
+
+	excludeDust := query.Get("exclude_dust") == "true"
+
+	unspent, err := s.readDB(w).GetUnspentOutputs(address)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	utxos := make([]coinselect.UTXO, 0, len(unspent))
+	for _, u := range unspent {
+		// Dust costs more in fees to spend than it is worth
+		if excludeDust && u.IsDust {
+			continue
+		}
+		utxos = append(utxos, coinselect.UTXO{TxHash: u.TxHash, Vout: u.Vout, Amount: int64(u.Amount)})
+	}
+
+	selection, err := strategy.Select(utxos, target)
+	if err == coinselect.ErrInsufficientFunds {
+		http.Error(w, "Insufficient funds", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := SelectionResponse{
+		Strategy: selection.Strategy,
+		Target:   spec.Amount(target),
+		Inputs:   make([]SelectedInput, len(selection.Inputs)),
+		Total:    spec.Amount(selection.Total),
+		Change:   spec.Amount(selection.Change),
+	}
+	for i, in := range selection.Inputs {
+		response.Inputs[i] = SelectedInput{TxHash: in.TxHash, Amount: spec.Amount(in.Amount)}
+		if in.Vout >= 0 {
+			vout := in.Vout
+			response.Inputs[i].Vout = &vout
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, response)
+}
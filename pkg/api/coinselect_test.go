@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/dogeorg/dogetracker/pkg/coinselect"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   int64
+		ok     bool
+	}{
+		{"100.5", 10_050_000_000, true},
+		{"0.00000001", 1, true},
+		{"10000000000", coinselect.MaxMoney, true},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"0.000000001", 0, false}, // rounds to 0 koinu
+		{"10000000000.5", 0, false},
+		{"1e300", 0, false},
+		{"NaN", 0, false},
+		{"nan", 0, false},
+		{"Inf", 0, false},
+		{"+Inf", 0, false},
+		{"-Inf", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTarget(tt.amount)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseTarget(%q) = %d, %v, want %d, %v", tt.amount, got, ok, tt.want, tt.ok)
+		}
+	}
+}
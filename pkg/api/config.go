@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+const configExportVersion = 1
+
+// ConfigExport is the document produced by /api/config/export
+// and accepted by /api/config/import.
+type ConfigExport struct {
+	Version   int                      `json:"version"`
+	Addresses []database.AddressConfig `json:"addresses"`
+}
+
+// handleConfigExport returns every tracked address with its settings (admin only)
+func (s *Server) handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticateAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	configs, err := s.db.GetAddressConfigs()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if configs == nil {
+		configs = []database.AddressConfig{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, ConfigExport{Version: configExportVersion, Addresses: configs})
+}
+
+// handleConfigImport tracks every address in an exported document (admin only).
+// Existing addresses have their settings overwritten. All-or-nothing: any
+// invalid entry rejects the whole import.
+func (s *Server) handleConfigImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticateAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if s.rejectWrite(w) {
+		return
+	}
+
+	var doc ConfigExport
+	if !s.decodeBody(w, r, &doc) {
+		return
+	}
+	if doc.Version != configExportVersion {
+		http.Error(w, fmt.Sprintf("Unsupported config version %d", doc.Version), http.StatusBadRequest)
+		return
+	}
+
+	for i := range doc.Addresses {
+		address, ok := normalizeAddress(doc.Addresses[i].Address)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invalid address: %s", doc.Addresses[i].Address), http.StatusBadRequest)
+			return
+		}
+		doc.Addresses[i].Address = address
+		if doc.Addresses[i].RequiredConfirmations < 1 {
+			doc.Addresses[i].RequiredConfirmations = 1
+		}
+		if !validConfirmationTiers(doc.Addresses[i].ConfirmationTiers) {
+			http.Error(w, fmt.Sprintf("Invalid confirmation_tiers for %s", address), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := s.db.TrackAddresses(doc.Addresses, s.maxAddresses)
+	if err == database.ErrAddressLimit {
+		http.Error(w, fmt.Sprintf("Import would exceed the tracked address limit (max %d)", s.maxAddresses), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("API: config import failed: %v", err)
+		http.Error(w, "Error importing addresses", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("API: imported %d tracked addresses (token=%s)", len(doc.Addresses), tokenID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"imported": len(doc.Addresses),
+	})
+}
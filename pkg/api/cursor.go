@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const rewindConfirmation = "rewind"
+
+// BlockCursor is implemented by the block processor so the API can move its cursor.
+type BlockCursor interface {
+	// Rewind makes the processor reprocess every block above height.
+	Rewind(height int64) error
+}
+
+// SetBlockCursor enables POST /api/cursor/rewind.
+func (s *Server) SetBlockCursor(cursor BlockCursor) {
+	s.cursor = cursor
+}
+
+type CursorResponse struct {
+	Height      int64  `json:"height"`
+	Hash        string `json:"hash"`
+	ProcessedAt string `json:"processed_at"`
+}
+
+func (s *Server) handleCursor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	block, err := s.db.GetLastProcessedBlock()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if block == nil {
+		http.Error(w, "No blocks processed yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, CursorResponse{
+		Height:      block.Height,
+		Hash:        block.Hash,
+		ProcessedAt: block.ProcessedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// handleCursorRewind deletes everything recorded above the requested height
+// and makes the block processor walk those blocks again.
+// Admin only; the body must be {"height": H, "confirm": "rewind"}.
+func (s *Server) handleCursorRewind(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticateAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if s.cursor == nil {
+		http.Error(w, "Block processor not available", http.StatusServiceUnavailable)
+		return
+	}
+	if s.rejectWrite(w) {
+		return
+	}
+
+	var req struct {
+		Height  *int64 `json:"height"`
+		Confirm string `json:"confirm"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Height == nil || *req.Height < 0 {
+		http.Error(w, "Missing or invalid height", http.StatusBadRequest)
+		return
+	}
+	if req.Confirm != rewindConfirmation {
+		http.Error(w, fmt.Sprintf("Rewind must be confirmed with \"confirm\": %q", rewindConfirmation), http.StatusBadRequest)
+		return
+	}
+
+	block, err := s.db.GetLastProcessedBlock()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if block == nil || *req.Height >= block.Height {
+		http.Error(w, "Height must be below the last processed block", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("API: rewinding block cursor from %d to %d (token=%s)", block.Height, *req.Height, tokenID(r))
+	if err := s.cursor.Rewind(*req.Height); err != nil {
+		http.Error(w, fmt.Sprintf("Error rewinding cursor: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"status":          "success",
+		"previous_height": block.Height,
+		"height":          *req.Height,
+	})
+}
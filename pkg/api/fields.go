@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// transactionFields are the fields ?fields= can select from transaction
+// objects (anything with a tx_hash: transactions, unspent outputs, details)
+var transactionFields = map[string]bool{
+	"tx_hash":        true,
+	"address":        true,
+	"amount":         true,
+	"block_height":   true,
+	"confirmations":  true,
+	"is_spent":       true,
+	"is_dust":        true,
+	"is_change":      true,
+	"size":           true,
+	"vsize":          true,
+	"created_at":     true,
+	"block_time":     true,
+	"median_time":    true,
+	"notes":          true,
+	"archived":       true,
+	"removal_reason": true,
+	"seq":            true,
+	"kind":           true,
+	"spent_height":   true,
+	"script":         true,
+	"script_type":    true,
+	"standard":       true,
+}
+
+// parseFields parses a ?fields=tx_hash,amount,confirmations list into a set
+// of snake_case field names. camelCase names and "txid" are accepted too.
+// Returns nil if no fields were requested.
+func parseFields(list string) (map[string]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+	fields := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = toSnake(strings.TrimSpace(name))
+		if name == "txid" {
+			name = "tx_hash"
+		}
+		if !transactionFields[name] {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// projectFields keeps only the requested fields of every transaction object
+// in a decoded JSON value. Other objects are left as they are.
+func projectFields(v interface{}, fields map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if _, ok := v["tx_hash"]; ok {
+			for k := range v {
+				if !fields[k] {
+					delete(v, k)
+				}
+			}
+			return v
+		}
+		for k, val := range v {
+			v[k] = projectFields(val, fields)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = projectFields(v[i], fields)
+		}
+	}
+	return v
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// JSONCase selects how JSON response field names are written.
+type JSONCase int
+
+const (
+	SnakeCase JSONCase = iota // tx_hash (the field names as declared)
+	CamelCase                 // txHash
+)
+
+// ParseJSONCase maps the -api-json-case flag value to a JSONCase.
+func ParseJSONCase(name string) (JSONCase, bool) {
+	switch strings.ToLower(name) {
+	case "snake", "snake_case":
+		return SnakeCase, true
+	case "camel", "camelcase":
+		return CamelCase, true
+	}
+	return SnakeCase, false
+}
+
+// SetJSONCase sets the field naming used in JSON responses.
+func (s *Server) SetJSONCase(c JSONCase) {
+	s.jsonCase = c
+}
+
+// bufferedResponse holds a handler's response so its body can be rewritten.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// rewriteJSON wraps the API handler to apply the response formatting
+// (?fields= projection, camelCase field names). Handlers keep encoding the
+// plain structs; the JSON is rewritten on the way out. Amounts are already
+// formatted, by writeJSON.
+func (s *Server) rewriteJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields, err := parseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			http.Error(w, "Invalid fields: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := parseUnit(r.URL.Query().Get("unit")); !ok {
+			http.Error(w, "Invalid unit", http.StatusBadRequest)
+			return
+		}
+		if fields == nil && s.jsonCase == SnakeCase {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedResponse{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		body := buf.body.Bytes()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			var v interface{}
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber() // keep amounts exactly as encoded
+			if err := dec.Decode(&v); err == nil {
+				if fields != nil {
+					v = projectFields(v, fields)
+				}
+				if s.jsonCase == CamelCase {
+					v = camelKeys(v)
+				}
+				var out bytes.Buffer
+				if err := json.NewEncoder(&out).Encode(v); err == nil {
+					body = out.Bytes()
+				}
+			}
+		}
+		w.WriteHeader(buf.status)
+		w.Write(body)
+	})
+}
+
+// camelKeys converts the object keys in a decoded JSON value to camelCase.
+func camelKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[toCamel(k)] = camelKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i := range v {
+			v[i] = camelKeys(v[i])
+		}
+		return v
+	}
+	return v
+}
+
+// toSnake converts a camelCase name to snake_case (txHash -> tx_hash).
+func toSnake(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// toCamel converts a snake_case name to camelCase (tx_hash -> txHash).
+func toCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/notify"
+)
+
+// LogLevel controls how much the API request logger writes.
+type LogLevel int
+
+const (
+	LogNone   LogLevel = iota // no request logging
+	LogErrors                 // only requests answered with a 4xx/5xx status
+	LogAll                    // every request
+)
+
+// ParseLogLevel maps the -api-log flag value to a LogLevel.
+func ParseLogLevel(level string) (LogLevel, bool) {
+	switch strings.ToLower(level) {
+	case "none", "off":
+		return LogNone, true
+	case "errors", "error":
+		return LogErrors, true
+	case "all":
+		return LogAll, true
+	}
+	return LogNone, false
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests wraps the API mux: it records per-route latency and writes an
+// access log line (method, path, token id, status, latency) at the configured level.
+func (s *Server) logRequests(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		// Use the matched route pattern, so per-address paths share one key.
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		s.latency.Observe(r.Method+" "+pattern, elapsed)
+
+		if s.logLevel == LogAll || (s.logLevel == LogErrors && rec.status >= 400) {
+			log.Printf("API %s %s token=%s status=%d latency=%s",
+				r.Method, r.URL.Path, tokenID(r), rec.status, elapsed.Round(time.Microsecond))
+		}
+	})
+}
+
+// tokenID identifies the bearer token in logs without revealing it:
+// the first 8 hex digits of its SHA-256.
+func tokenID(r *http.Request) string {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return "-"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
+
+// WebhookMetrics reports webhook delivery counts and latency
+type WebhookMetrics interface {
+	WebhookStats() notify.WebhookStats
+}
+
+// SetWebhookMetrics makes /api/metrics report webhook deliveries.
+func (s *Server) SetWebhookMetrics(webhook WebhookMetrics) {
+	s.webhook = webhook
+}
+
+// EventMetrics reports the internal events published by block processing
+type EventMetrics interface {
+	EventCounts() map[string]uint64
+}
+
+// SetEventMetrics makes /api/metrics report internal event counts.
+func (s *Server) SetEventMetrics(events EventMetrics) {
+	s.events = events
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	metrics := map[string]interface{}{
+		"latency": s.latency.Snapshot(),
+	}
+	if s.webhook != nil {
+		metrics["webhook"] = s.webhook.WebhookStats()
+	}
+	if s.events != nil {
+		metrics["events"] = s.events.EventCounts()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, metrics)
+}
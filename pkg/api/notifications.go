@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+const (
+	maxReplayDays   = 31 // longest from-to range per replay
+	maxReplayEvents = 10000
+)
+
+// ReplayEvent is a reconstructed spendable event in a replay response
+type ReplayEvent struct {
+	Type          string      `json:"type"`
+	Address       string      `json:"address"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	Replay        bool        `json:"replay"`
+	Time          time.Time   `json:"time"` // when the deposit was recorded
+}
+
+// handleReplay reconstructs the spendable events of deposits recorded in a
+// time range, from the transactions, and returns them or queues them for
+// the webhook again (admin only). Replayed events carry "replay": true.
+// POST /api/notifications/replay
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticateAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Address string    `json:"address"` // optional, every address if empty
+		From    time.Time `json:"from"`
+		To      time.Time `json:"to"`
+		Deliver bool      `json:"deliver"` // queue for the webhook instead of only returning them
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Address != "" {
+		address, ok := normalizeAddress(req.Address)
+		if !ok {
+			http.Error(w, "Invalid address", http.StatusBadRequest)
+			return
+		}
+		req.Address = address
+	}
+	if req.From.IsZero() || req.To.IsZero() || !req.To.After(req.From) {
+		http.Error(w, "Missing or invalid from/to", http.StatusBadRequest)
+		return
+	}
+	if req.To.Sub(req.From) > maxReplayDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("Range too long (max %d days)", maxReplayDays), http.StatusBadRequest)
+		return
+	}
+	if req.Deliver && s.webhook == nil {
+		http.Error(w, "No webhook configured", http.StatusBadRequest)
+		return
+	}
+	if req.Deliver && s.rejectWrite(w) {
+		return
+	}
+
+	events, err := s.db.GetSpendableEvents(req.Address, req.From.UTC(), req.To.UTC(), maxReplayEvents+1)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(events) > maxReplayEvents {
+		http.Error(w, fmt.Sprintf("Too many events (max %d), use a shorter range", maxReplayEvents), http.StatusBadRequest)
+		return
+	}
+
+	if req.Deliver {
+		if err := s.db.QueueReplayEvents(events); err != nil {
+			log.Printf("API: notification replay failed: %v", err)
+			http.Error(w, "Error queueing events", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("API: queued %d replayed events (token=%s)", len(events), tokenID(r))
+	}
+
+	replayed := make([]ReplayEvent, len(events))
+	for i, e := range events {
+		replayed[i] = replayEvent(e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]interface{}{
+		"events": replayed,
+		"queued": req.Deliver,
+	})
+}
+
+func replayEvent(e database.WebhookEvent) ReplayEvent {
+	return ReplayEvent{
+		Type:          e.Type,
+		Address:       e.Address,
+		TxHash:        e.TxHash,
+		Amount:        e.Amount,
+		BlockHeight:   e.BlockHeight,
+		Confirmations: e.Confirmations,
+		Replay:        true,
+		Time:          e.CreatedAt,
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// transactionPage is a page of an address's transactions, newest first,
+// starting after the (height, id) cursor if after is set
+type transactionPage struct {
+	limit  int
+	after  bool
+	height int64
+	id     int64
+	lastID int64 // id of the last transaction on the page so far
+}
+
+// parsePage parses ?limit= and ?cursor=. Returns nil if neither is given,
+// i.e. the whole history is requested, and false if either is invalid.
+func parsePage(r *http.Request) (*transactionPage, bool) {
+	limitValue := r.URL.Query().Get("limit")
+	cursor := r.URL.Query().Get("cursor")
+	if limitValue == "" && cursor == "" {
+		return nil, true
+	}
+	page := &transactionPage{limit: defaultPageSize}
+	if limitValue != "" {
+		limit, err := strconv.Atoi(limitValue)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return nil, false
+		}
+		page.limit = limit
+	}
+	if cursor != "" {
+		height, id, ok := parsePageCursor(cursor)
+		if !ok {
+			return nil, false
+		}
+		page.after, page.height, page.id = true, height, id
+	}
+	return page, true
+}
+
+// pageCursor encodes the position after a transaction. Clients should
+// treat it as opaque.
+func pageCursor(height, id int64) string {
+	return fmt.Sprintf("%d-%d", height, id)
+}
+
+func parsePageCursor(cursor string) (height, id int64, ok bool) {
+	parts := strings.SplitN(cursor, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	height, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || height < 0 {
+		return 0, 0, false
+	}
+	id, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || id < 0 {
+		return 0, 0, false
+	}
+	return height, id, true
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *transactionPage
+		ok    bool
+	}{
+		{"", nil, true},
+		{"?limit=10", &transactionPage{limit: 10}, true},
+		{"?cursor=4500000-123", &transactionPage{limit: defaultPageSize, after: true, height: 4500000, id: 123}, true},
+		{"?limit=1000&cursor=0-0", &transactionPage{limit: 1000, after: true}, true},
+		{"?limit=0", nil, false},
+		{"?limit=1001", nil, false},
+		{"?limit=abc", nil, false},
+		{"?cursor=123", nil, false},
+		{"?cursor=-1-5", nil, false},
+		{"?cursor=5--1", nil, false},
+		{"?cursor=a-b", nil, false},
+		{"?cursor=1-2-3", nil, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/address/D"+tt.query, nil)
+		got, ok := parsePage(r)
+		if ok != tt.ok {
+			t.Errorf("parsePage(%q) ok = %v, want %v", tt.query, ok, tt.ok)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("parsePage(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+type pageRow struct {
+	height, id int64
+}
+
+// listPage returns up to limit rows after the cursor and the next cursor,
+// with the listing query's WHERE and ORDER BY: (block_height, id) below the
+// cursor, newest first
+func listPage(rows []pageRow, page *transactionPage) ([]pageRow, string) {
+	sorted := append([]pageRow(nil), rows...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].height != sorted[j].height {
+			return sorted[i].height > sorted[j].height
+		}
+		return sorted[i].id > sorted[j].id
+	})
+	var result []pageRow
+	for _, row := range sorted {
+		if page.after && (row.height > page.height || row.height == page.height && row.id >= page.id) {
+			continue
+		}
+		if len(result) == page.limit {
+			last := result[len(result)-1]
+			return result, pageCursor(last.height, last.id)
+		}
+		result = append(result, row)
+	}
+	return result, ""
+}
+
+func TestPageIterationIsStableAcrossInserts(t *testing.T) {
+	// Ids are assigned in insertion order, which is not height order when
+	// a rescan or reprocess records older blocks
+	var rows []pageRow
+	nextID := int64(1)
+	insert := func(height int64) {
+		rows = append(rows, pageRow{height, nextID})
+		nextID++
+	}
+	for height := int64(100); height < 120; height++ {
+		insert(height)
+		if height%3 == 0 {
+			insert(height) // two transactions in one block
+		}
+	}
+	insert(105) // recorded late
+	before := append([]pageRow(nil), rows...)
+
+	seen := make(map[pageRow]bool)
+	var listed []pageRow
+	cursor := ""
+	for pages := 0; ; pages++ {
+		query := "?limit=4"
+		if cursor != "" {
+			query += "&cursor=" + cursor
+		}
+		page, ok := parsePage(httptest.NewRequest("GET", "/api/address/D"+query, nil))
+		if !ok {
+			t.Fatalf("parsePage(%q) rejected its own cursor", query)
+		}
+		var result []pageRow
+		result, cursor = listPage(rows, page)
+		for _, row := range result {
+			if seen[row] {
+				t.Errorf("row %+v listed twice", row)
+			}
+			seen[row] = true
+			if n := len(listed); n > 0 && (row.height > listed[n-1].height || row.height == listed[n-1].height && row.id > listed[n-1].id) {
+				t.Errorf("row %+v listed after %+v", row, listed[n-1])
+			}
+			listed = append(listed, row)
+		}
+
+		// New blocks arrive between pages
+		insert(int64(200 + pages))
+		if cursor == "" {
+			break
+		}
+	}
+
+	for _, row := range before {
+		if !seen[row] {
+			t.Errorf("row %+v present from the start was skipped", row)
+		}
+	}
+	if len(listed) != len(before) {
+		t.Errorf("listed %d rows, want the %d present from the start", len(listed), len(before))
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+// MerkleProver is implemented by the node client so the API can serve
+// merkle inclusion proofs.
+type MerkleProver interface {
+	GetMerkleProof(txid string, height int64) (spec.MerkleProof, error)
+}
+
+// SetMerkleProver enables GET /api/address/{addr}/proof.
+func (s *Server) SetMerkleProver(prover MerkleProver) {
+	s.prover = prover
+}
+
+// handleProof returns a merkle proof that a transaction received by address
+// is included in its block, for clients verifying it against the header
+// without trusting the tracker.
+// GET /api/address/{addr}/proof?txid=T
+func (s *Server) handleProof(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.prover == nil {
+		http.Error(w, "Node not available", http.StatusServiceUnavailable)
+		return
+	}
+	txid := strings.ToLower(r.URL.Query().Get("txid"))
+	if !isValidTxID(txid) {
+		http.Error(w, "Missing or invalid txid", http.StatusBadRequest)
+		return
+	}
+
+	height, found, err := s.readDB(w).GetReceivedHeight(address, txid)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	proof, err := s.prover.GetMerkleProof(txid, height)
+	if err != nil {
+		log.Printf("API: merkle proof for %s failed: %v", txid, err)
+		http.Error(w, "Error getting proof from node", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, proof)
+}
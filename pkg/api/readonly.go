@@ -0,0 +1,62 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// ReadOnlyMode is implemented by the block processor so the API can pause
+// and resume database writes, e.g. for a maintenance window.
+type ReadOnlyMode interface {
+	ReadOnly() bool
+	SetReadOnly(readOnly bool)
+}
+
+// SetReadOnlyMode enables POST /api/read-only, makes /api/status report
+// the mode and makes write endpoints fail with 503 while it is on.
+func (s *Server) SetReadOnlyMode(mode ReadOnlyMode) {
+	s.readOnly = mode
+}
+
+// rejectWrite answers 503 and returns true if writes are paused
+func (s *Server) rejectWrite(w http.ResponseWriter) bool {
+	if s.readOnly == nil || !s.readOnly.ReadOnly() {
+		return false
+	}
+	http.Error(w, "Read-only mode, writes are paused", http.StatusServiceUnavailable)
+	return true
+}
+
+// handleReadOnly turns read-only mode on or off (admin only).
+// POST /api/read-only with {"read_only": true|false}
+func (s *Server) handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticateAdmin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if s.readOnly == nil {
+		http.Error(w, "Block processor not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ReadOnly *bool `json:"read_only"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.ReadOnly == nil {
+		http.Error(w, "Missing read_only", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("API: read-only mode %v (token=%s)", *req.ReadOnly, tokenID(r))
+	s.readOnly.SetReadOnly(*req.ReadOnly)
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, map[string]bool{"read_only": *req.ReadOnly})
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+// SetReadReplica sets a read-only replica connection used by the read
+// endpoints, keeping their queries off the primary that block processing
+// writes to. Without one, reads use the primary.
+func (s *Server) SetReadReplica(db *database.DB) {
+	s.replica = db
+}
+
+// readDB returns the connection read endpoints should query. When it is a
+// replica, the response carries an X-Replica-Lag header (seconds behind the
+// primary) so clients can tell how stale the data may be.
+func (s *Server) readDB(w http.ResponseWriter) *database.DB {
+	if s.replica == nil {
+		return s.db
+	}
+	if lag, ok, err := s.replica.ReplicationLag(); err == nil && ok {
+		w.Header().Set("X-Replica-Lag", fmt.Sprintf("%.3f", lag.Seconds()))
+	}
+	return s.replica
+}
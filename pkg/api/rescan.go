@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AddressRescanner is implemented by the block processor so the API can
+// rebuild a single address's history.
+type AddressRescanner interface {
+	// Rescan deletes what is recorded for address from fromHeight up and
+	// walks those blocks again for that address only, in the background.
+	Rescan(address string, fromHeight int64) error
+	// Rescans reports the progress of running and finished rescans.
+	Rescans() []RescanStatus
+}
+
+// RescanStatus is the progress of one address rescan
+type RescanStatus struct {
+	Address    string     `json:"address"`
+	FromHeight int64      `json:"from_height"`
+	NextHeight int64      `json:"next_height"` // next block to scan
+	Done       bool       `json:"done"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// SetRescanner enables POST /api/address/{addr}/rescan.
+func (s *Server) SetRescanner(rescanner AddressRescanner) {
+	s.rescanner = rescanner
+}
+
+// handleRescan starts a background rescan of one address (admin only).
+// POST /api/address/{addr}/rescan?from_height=H
+func (s *Server) handleRescan(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.rescanner == nil {
+		http.Error(w, "Block processor not available", http.StatusServiceUnavailable)
+		return
+	}
+	if s.rejectWrite(w) {
+		return
+	}
+	fromHeight, err := strconv.ParseInt(r.URL.Query().Get("from_height"), 10, 64)
+	if err != nil || fromHeight < 0 {
+		http.Error(w, "Missing or invalid from_height", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("API: rescanning %s from height %d (token=%s)", address, fromHeight, tokenID(r))
+	if err := s.rescanner.Rescan(address, fromHeight); err != nil {
+		http.Error(w, fmt.Sprintf("Error starting rescan: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	s.writeJSON(w, r, map[string]interface{}{
+		"status":      "started",
+		"address":     address,
+		"from_height": fromHeight,
+	})
+}
+
+// LeaderStatus reports this instance's role when leader election is enabled
+type LeaderStatus interface {
+	IsLeader() bool
+}
+
+// SetLeaderStatus makes /api/status report the leader/standby role.
+func (s *Server) SetLeaderStatus(leader LeaderStatus) {
+	s.leader = leader
+}
+
+// SyncStatus reports whether block processing is catching up or following the tip
+type SyncStatus interface {
+	CatchingUp() bool
+	BalancesDeferred() bool
+}
+
+// SetSyncStatus makes /api/status report "catching_up" or "following".
+func (s *Server) SetSyncStatus(status SyncStatus) {
+	s.sync = status
+}
+
+// RPCBreaker reports the state of the node RPC circuit breaker
+type RPCBreaker interface {
+	Status() (state string, failures int, retryAt time.Time)
+}
+
+// SetRPCBreaker makes /api/status report the node RPC circuit breaker.
+func (s *Server) SetRPCBreaker(breaker RPCBreaker) {
+	s.breaker = breaker
+}
+
+// BreakerStatus is the node RPC circuit breaker in /api/status
+type BreakerStatus struct {
+	State    string     `json:"state"`    // "closed", "open" or "half-open"
+	Failures int        `json:"failures"` // consecutive failed calls
+	RetryAt  *time.Time `json:"retry_at,omitempty"`
+}
+
+// StatusResponse is returned by /api/status
+type StatusResponse struct {
+	Height           int64          `json:"height"`          // last processed block, -1 if none
+	Role             string         `json:"role,omitempty"`  // "leader" or "standby" with leader election
+	State            string         `json:"state,omitempty"` // "catching_up" or "following"
+	BalancesDeferred bool           `json:"balances_deferred,omitempty"`
+	ReadOnly         bool           `json:"read_only"` // database writes are paused
+	RPCBreaker       *BreakerStatus `json:"rpc_breaker,omitempty"`
+	Rescans          []RescanStatus `json:"rescans"`
+}
+
+// handleStatus reports block processing progress and address rescans
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status := StatusResponse{Height: -1, Rescans: []RescanStatus{}}
+	block, err := s.db.GetLastProcessedBlock()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		status.Height = block.Height
+	}
+	if s.leader != nil {
+		status.Role = "standby"
+		if s.leader.IsLeader() {
+			status.Role = "leader"
+		}
+	}
+	if s.sync != nil {
+		status.State = "following"
+		if s.sync.CatchingUp() {
+			status.State = "catching_up"
+		}
+		status.BalancesDeferred = s.sync.BalancesDeferred()
+	}
+	if s.breaker != nil {
+		state, failures, retryAt := s.breaker.Status()
+		status.RPCBreaker = &BreakerStatus{State: state, Failures: failures}
+		if !retryAt.IsZero() {
+			status.RPCBreaker.RetryAt = &retryAt
+		}
+	}
+	if s.rescanner != nil {
+		status.Rescans = append(status.Rescans, s.rescanner.Rescans()...)
+	}
+	if s.readOnly != nil {
+		status.ReadOnly = s.readOnly.ReadOnly()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, status)
+}
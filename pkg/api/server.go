@@ -3,19 +3,53 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/dogeorg/doge"
 	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/metrics"
+	"github.com/dogeorg/dogetracker/pkg/spec"
 )
 
+// chain is the network whose addresses the API accepts
+var chain = &doge.DogeMainNetChain
+
 type Server struct {
-	db    *database.DB
-	port  int
-	token string
+	db               *database.DB
+	replica          *database.DB // optional, for read endpoints
+	listener         net.Listener
+	port             int
+	unixSocket       string // listen on this socket path instead of port
+	token            string
+	adminToken       string
+	logLevel         LogLevel
+	jsonCase         JSONCase
+	amountsAsStrings bool
+	latency          *metrics.Latency
+	cursor           BlockCursor
+	rescanner        AddressRescanner
+	reprocessor      BlockReprocessor
+	prover           MerkleProver
+	leader           LeaderStatus
+	breaker          RPCBreaker
+	sync             SyncStatus
+	webhook          WebhookMetrics
+	events           EventMetrics
+	readOnly         ReadOnlyMode
+
+	maxAddresses int   // 0 means unlimited
+	maxBody      int64 // request body size limit in bytes
+
+	confirmations *confirmationsSignal
+	waiters       chan struct{} // bounds concurrent long-poll requests
 }
 
 type TrackRequest struct {
@@ -25,12 +59,23 @@ type TrackRequest struct {
 
 func NewServer(db *database.DB, port int, token string) *Server {
 	return &Server{
-		db:    db,
-		port:  port,
-		token: token,
+		db:       db,
+		port:     port,
+		token:    token,
+		logLevel: LogErrors,
+		latency:  metrics.NewLatency(0),
+		maxBody:  DefaultMaxBodySize,
+
+		confirmations: newConfirmationsSignal(),
+		waiters:       make(chan struct{}, maxWaiters),
 	}
 }
 
+// SetLogLevel sets the verbosity of the API access log.
+func (s *Server) SetLogLevel(level LogLevel) {
+	s.logLevel = level
+}
+
 func (s *Server) authenticate(r *http.Request) bool {
 	auth := r.Header.Get("Authorization")
 	if auth == "" {
@@ -45,28 +90,72 @@ func (s *Server) authenticate(r *http.Request) bool {
 	return parts[1] == s.token
 }
 
+// SetAdminToken sets the token required by admin endpoints.
+// Admin endpoints are disabled while it is empty.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// SetMaxAddresses caps the total number of tracked addresses.
+// Zero (the default) means unlimited.
+func (s *Server) SetMaxAddresses(max int) {
+	s.maxAddresses = max
+}
+
+// DefaultMaxBodySize is the default request body size limit
+const DefaultMaxBodySize = 1 << 20
+
+// SetMaxBodySize limits request bodies to max bytes; larger ones are
+// rejected with 413 Request Entity Too Large.
+func (s *Server) SetMaxBodySize(max int64) {
+	s.maxBody = max
+}
+
+// decodeBody decodes the JSON request body into v. If the body is over the
+// size limit or invalid it answers 413 or 400 and returns false.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		// MaxBytesReader's error has no exported type before Go 1.19
+		if err.Error() == "http: request body too large" {
+			http.Error(w, fmt.Sprintf("Request body too large (max %d bytes)", s.maxBody), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Server) authenticateAdmin(r *http.Request) bool {
+	if s.adminToken == "" {
+		return false
+	}
+	return r.Header.Get("Authorization") == "Bearer "+s.adminToken
+}
+
 type AddressResponse struct {
 	Address        string                  `json:"address"`
-	Balance        float64                 `json:"balance"`
+	Balance        spec.Amount             `json:"balance"`
 	Transactions   []TransactionResponse   `json:"transactions"`
 	UnspentOutputs []UnspentOutputResponse `json:"unspent_outputs"`
 }
 
 type TransactionResponse struct {
-	TxHash        string  `json:"tx_hash"`
-	Amount        float64 `json:"amount"`
-	BlockHeight   int64   `json:"block_height"`
-	Confirmations int     `json:"confirmations"`
-	IsSpent       bool    `json:"is_spent"`
-	CreatedAt     string  `json:"created_at"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	IsSpent       bool        `json:"is_spent"`
+	CreatedAt     string      `json:"created_at"`
 }
 
 type UnspentOutputResponse struct {
-	TxHash        string  `json:"tx_hash"`
-	Amount        float64 `json:"amount"`
-	BlockHeight   int64   `json:"block_height"`
-	Confirmations int     `json:"confirmations"`
-	CreatedAt     string  `json:"created_at"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	CreatedAt     string      `json:"created_at"`
 }
 
 func (s *Server) handleAddress(w http.ResponseWriter, r *http.Request) {
@@ -148,17 +237,36 @@ func (s *Server) handleAddress(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	s.writeJSON(w, r, response)
 }
 
-// isValidAddress checks if the given string is a valid Dogecoin address
-func isValidAddress(address string) bool {
-	// Basic validation - Dogecoin addresses start with 'D' and are 34 characters long
-	if len(address) != 34 || !strings.HasPrefix(address, "D") {
-		return false
+// normalizeAddress trims whitespace and canonicalizes a Dogecoin address by
+// base58check decoding and re-encoding it. Returns false if the address is
+// not a valid P2PKH or P2SH address on the tracked chain.
+func normalizeAddress(address string) (string, bool) {
+	address = strings.TrimSpace(address)
+	payload, err := doge.Base58DecodeCheck(address)
+	if err != nil || len(payload) != 21 {
+		return "", false
 	}
-	// TODO: Add more thorough validation if needed
-	return true
+	if payload[0] != chain.P2PKH_Address_Prefix && payload[0] != chain.P2SH_Address_Prefix {
+		return "", false
+	}
+	return doge.Base58EncodeCheck(payload), true
+}
+
+// pathParts splits the request path after prefix into its segments,
+// percent-decoding each one and ignoring a trailing slash, so
+// "/api/address/D...%20/history/" gives ["D... ", "history"].
+func pathParts(r *http.Request, prefix string) []string {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/")
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			parts[i] = unescaped
+		}
+	}
+	return parts
 }
 
 func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
@@ -172,72 +280,145 @@ func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if s.rejectWrite(w) {
+		return
+	}
 
 	// Parse request body
 	var req struct {
-		Address               string `json:"address"`
-		RequiredConfirmations int64  `json:"required_confirmations"`
+		Address               string                      `json:"address"`
+		RequiredConfirmations int64                       `json:"required_confirmations"`
+		ConfirmationTiers     []database.ConfirmationTier `json:"confirmation_tiers"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 
-	// Validate address
-	if !isValidAddress(req.Address) {
+	// Validate and normalize address
+	address, ok := normalizeAddress(req.Address)
+	if !ok {
 		http.Error(w, "Invalid address", http.StatusBadRequest)
 		return
 	}
+	req.Address = address
 
 	// Validate required confirmations
 	if req.RequiredConfirmations < 1 {
 		req.RequiredConfirmations = 1 // Default to 1 confirmation if not specified
 	}
+	if !validConfirmationTiers(req.ConfirmationTiers) {
+		http.Error(w, "Invalid confirmation_tiers", http.StatusBadRequest)
+		return
+	}
 
 	// Add address to database
-	_, err := s.db.Exec(`
-		INSERT INTO addresses (address, required_confirmations)
-		VALUES ($1, $2)
-		ON CONFLICT (address) DO UPDATE
-		SET required_confirmations = $2, updated_at = NOW()
-	`, req.Address, req.RequiredConfirmations)
+	err := s.db.TrackAddresses([]database.AddressConfig{{
+		Address:               req.Address,
+		RequiredConfirmations: req.RequiredConfirmations,
+		ConfirmationTiers:     req.ConfirmationTiers,
+	}}, s.maxAddresses)
+	if err == database.ErrAddressLimit {
+		http.Error(w, fmt.Sprintf("Tracked address limit reached (max %d)", s.maxAddresses), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error tracking address", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
+	s.writeJSON(w, r, map[string]string{
 		"status":  "success",
 		"message": "Address tracked successfully",
 	})
 }
 
+// validConfirmationTiers checks that every tier has a non-negative
+// min_amount, at least 1 required confirmation, and that no two tiers share
+// a min_amount.
+func validConfirmationTiers(tiers []database.ConfirmationTier) bool {
+	seen := make(map[float64]bool, len(tiers))
+	for _, t := range tiers {
+		if t.MinAmount < 0 || t.RequiredConfirmations < 1 || seen[t.MinAmount] {
+			return false
+		}
+		seen[t.MinAmount] = true
+	}
+	return true
+}
+
 type AddressInfo struct {
 	Address        string          `json:"address"`
-	Balance        float64         `json:"balance"`
+	Balance        spec.Amount     `json:"balance"`
 	Transactions   []Transaction   `json:"transactions"`
+	NextCursor     string          `json:"next_cursor,omitempty"` // with ?limit=, if there are more transactions
 	UnspentOutputs []UnspentOutput `json:"unspent_outputs"`
 }
 
 type Transaction struct {
-	TxHash        string    `json:"tx_hash"`
-	Amount        float64   `json:"amount"`
-	BlockHeight   int64     `json:"block_height"`
-	Confirmations int       `json:"confirmations"`
-	IsSpent       bool      `json:"is_spent"`
-	CreatedAt     time.Time `json:"created_at"`
+	TxHash        string                     `json:"tx_hash"`
+	Amount        spec.Amount                `json:"amount"`
+	BlockHeight   int64                      `json:"block_height"`
+	Confirmations int                        `json:"confirmations"`
+	IsSpent       bool                       `json:"is_spent"`
+	IsDust        bool                       `json:"is_dust"`
+	IsChange      bool                       `json:"is_change"`
+	Size          *int                       `json:"size"`
+	VSize         *int                       `json:"vsize"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	BlockTime     *time.Time                 `json:"block_time"`  // block header time, if stored
+	MedianTime    *time.Time                 `json:"median_time"` // block median-time-past, if stored
+	Notes         []database.TransactionNote `json:"notes,omitempty"`
+	RemovalReason string                     `json:"removal_reason,omitempty"` // ?status=dropped only
+}
+
+// Transaction statuses for ?status=
+const (
+	StatusConfirmed = "confirmed" // at least the required confirmations for the amount
+	StatusPending   = "pending"   // fewer confirmations
+	StatusDropped   = "dropped"   // removed by a rewind or rescan
+)
+
+// transactionStatus returns StatusConfirmed or StatusPending
+func transactionStatus(confirmations, requiredConfirmations int) string {
+	if requiredConfirmations < 1 {
+		requiredConfirmations = 1
+	}
+	if confirmations >= requiredConfirmations {
+		return StatusConfirmed
+	}
+	return StatusPending
 }
 
 type UnspentOutput struct {
-	TxHash        string    `json:"tx_hash"`
-	Amount        float64   `json:"amount"`
-	BlockHeight   int64     `json:"block_height"`
-	Confirmations int       `json:"confirmations"`
-	CreatedAt     time.Time `json:"created_at"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	IsDust        bool        `json:"is_dust"`
+	IsChange      bool        `json:"is_change"`
+	CreatedAt     time.Time   `json:"created_at"`
+
+	// Only with ?scripts=true, and only for outputs recorded since scripts
+	// are stored
+	Address    string  `json:"address,omitempty"`
+	Script     *string `json:"script,omitempty"`
+	ScriptType *string `json:"script_type,omitempty"`
+	Standard   *bool   `json:"standard,omitempty"`
 }
 
-func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
+// signableScriptTypes are the output types a wallet can build the input
+// script for from its keys (plus the redeem script, for scripthash)
+var signableScriptTypes = map[string]bool{
+	"pubkey":     true,
+	"pubkeyhash": true,
+	"scripthash": true,
+	"multisig":   true,
+}
+
+// handleGetAddress returns an address's balance, transactions and unspent
+// outputs. rawAddress is the address path segment, before normalization.
+func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request, rawAddress string) {
 	// Check authorization
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -250,13 +431,34 @@ func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get address from URL path
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) != 4 {
+	address, ok := normalizeAddress(rawAddress)
+	if !ok {
 		http.Error(w, "Invalid address", http.StatusBadRequest)
 		return
 	}
-	address := parts[3]
+
+	tip, useTip, err := tipHeight(r)
+	if err != nil {
+		http.Error(w, "Invalid tip_height", http.StatusBadRequest)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != StatusConfirmed && status != StatusPending && status != StatusDropped {
+		http.Error(w, "Invalid status (use confirmed, pending or dropped)", http.StatusBadRequest)
+		return
+	}
+	scripts := r.URL.Query().Get("scripts") == "true"
+	page, ok := parsePage(r)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid limit (1 to %d) or cursor", maxPageSize), http.StatusBadRequest)
+		return
+	}
+	if page != nil && status == StatusDropped {
+		http.Error(w, "Pagination is not supported with status=dropped", http.StatusBadRequest)
+		return
+	}
+
+	db := s.readDB(w)
 
 	// Get address info
 	var info AddressInfo
@@ -264,7 +466,7 @@ func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
 
 	// Get address ID
 	var addressID int64
-	err := s.db.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
+	err = db.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Address not found", http.StatusNotFound)
@@ -275,7 +477,7 @@ func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get balance
-	err = s.db.QueryRow(`
+	err = db.QueryRow(`
 		SELECT COALESCE(SUM(amount), 0)
 		FROM unspent_transactions
 		WHERE address_id = $1
@@ -285,13 +487,33 @@ func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get transactions
-	rows, err := s.db.Query(`
-		SELECT tx_hash, amount, block_height, confirmations, is_spent, created_at
-		FROM transactions
-		WHERE address_id = $1
-		ORDER BY created_at DESC
-	`, addressID)
+	// Get transactions, with the confirmations each one needs. A page is
+	// read in (block_height, id) order from the cursor on, so it costs the
+	// same however deep it is.
+	var rows *sql.Rows
+	if page == nil {
+		rows, err = db.Query(`
+			SELECT t.id, t.tx_hash, t.amount, t.block_height, t.confirmations, t.is_spent, t.is_dust, t.is_change, t.size, t.vsize, t.created_at,
+				b.block_time, b.median_time,
+				required_confirmations_for(a.required_confirmations, a.confirmation_tiers, t.amount)
+			FROM transactions t
+			JOIN addresses a ON a.id = t.address_id
+			LEFT JOIN block_hashes b ON b.height = t.block_height
+			WHERE t.address_id = $1 AND $2 <> 'dropped'
+			ORDER BY t.created_at DESC
+		`, addressID, status)
+	} else {
+		rows, err = db.Query(`
+			SELECT t.id, t.tx_hash, t.amount, t.block_height, t.confirmations, t.is_spent, t.is_dust, t.is_change, t.size, t.vsize, t.created_at,
+				b.block_time, b.median_time,
+				required_confirmations_for(a.required_confirmations, a.confirmation_tiers, t.amount)
+			FROM transactions t
+			JOIN addresses a ON a.id = t.address_id
+			LEFT JOIN block_hashes b ON b.height = t.block_height
+			WHERE t.address_id = $1 AND (NOT $2 OR (t.block_height, t.id) < ($3, $4))
+			ORDER BY t.block_height DESC, t.id DESC
+		`, addressID, page.after, page.height, page.id)
+	}
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -300,20 +522,69 @@ func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var tx Transaction
-		err := rows.Scan(&tx.TxHash, &tx.Amount, &tx.BlockHeight, &tx.Confirmations, &tx.IsSpent, &tx.CreatedAt)
+		var id int64
+		var requiredConfirmations int
+		err := rows.Scan(&id, &tx.TxHash, &tx.Amount, &tx.BlockHeight, &tx.Confirmations, &tx.IsSpent, &tx.IsDust, &tx.IsChange, &tx.Size, &tx.VSize, &tx.CreatedAt, &tx.BlockTime, &tx.MedianTime, &requiredConfirmations)
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if useTip {
+			tx.Confirmations = confirmationsAt(tip, tx.BlockHeight)
+		}
+		if status != "" && transactionStatus(tx.Confirmations, requiredConfirmations) != status {
+			continue
+		}
+		if page != nil && len(info.Transactions) == page.limit {
+			// One more past the page: there is a next one
+			last := info.Transactions[len(info.Transactions)-1]
+			info.NextCursor = pageCursor(last.BlockHeight, page.lastID)
+			break
+		}
 		info.Transactions = append(info.Transactions, tx)
+		if page != nil {
+			page.lastID = id
+		}
+	}
+	rows.Close()
+
+	// Dropped transactions come from the removal history instead; their
+	// created_at is when they were removed
+	if status == StatusDropped {
+		dropped, err := db.GetDroppedTransactions(address)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, d := range dropped {
+			info.Transactions = append(info.Transactions, Transaction{
+				TxHash:        d.TxHash,
+				Amount:        d.Amount,
+				BlockHeight:   d.BlockHeight,
+				CreatedAt:     d.RemovedAt,
+				RemovalReason: d.RemovalReason,
+			})
+		}
+	}
+
+	// Attach notes
+	notes, err := db.GetAddressNotes(addressID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range info.Transactions {
+		info.Transactions[i].Notes = notes[info.Transactions[i].TxHash]
 	}
 
 	// Get unspent outputs
-	rows, err = s.db.Query(`
-		SELECT tx_hash, amount, block_height, confirmations, created_at
-		FROM unspent_transactions
-		WHERE address_id = $1
-		ORDER BY created_at DESC
+	rows, err = db.Query(`
+		SELECT ut.tx_hash, ut.amount, ut.block_height, ut.confirmations, ut.is_dust, ut.is_change, ut.created_at,
+			t.script, t.script_type
+		FROM unspent_transactions ut
+		LEFT JOIN transactions t ON t.address_id = ut.address_id AND t.tx_hash = ut.tx_hash AND t.block_height = ut.block_height
+		WHERE ut.address_id = $1
+		ORDER BY ut.created_at DESC
 	`, addressID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -323,22 +594,102 @@ func (s *Server) handleGetAddress(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var utxo UnspentOutput
-		err := rows.Scan(&utxo.TxHash, &utxo.Amount, &utxo.BlockHeight, &utxo.Confirmations, &utxo.CreatedAt)
+		var script, scriptType sql.NullString
+		err := rows.Scan(&utxo.TxHash, &utxo.Amount, &utxo.BlockHeight, &utxo.Confirmations, &utxo.IsDust, &utxo.IsChange, &utxo.CreatedAt, &script, &scriptType)
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if scripts {
+			utxo.Address = address
+			if script.Valid {
+				utxo.Script = &script.String
+			}
+			if scriptType.Valid {
+				standard := signableScriptTypes[scriptType.String]
+				utxo.ScriptType = &scriptType.String
+				utxo.Standard = &standard
+			}
+		}
+		if useTip {
+			utxo.Confirmations = confirmationsAt(tip, utxo.BlockHeight)
+		}
 		info.UnspentOutputs = append(info.UnspentOutputs, utxo)
 	}
 
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(info)
+	s.writeJSON(w, r, info)
 }
 
+// SetUnixSocket makes the API listen on a Unix domain socket at path
+// instead of the TCP port, so it is only reachable through the local
+// filesystem (subject to the socket file's permissions).
+func (s *Server) SetUnixSocket(path string) {
+	s.unixSocket = path
+}
+
+// Listen binds the API port, so a port conflict can be reported at startup
+// rather than from the goroutine running Start.
+func (s *Server) Listen() error {
+	if s.unixSocket != "" {
+		// A socket file left behind by an unclean exit would make this fail
+		if err := os.Remove(s.unixSocket); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing stale socket %s: %v", s.unixSocket, err)
+		}
+		listener, err := net.Listen("unix", s.unixSocket)
+		if err != nil {
+			return fmt.Errorf("error listening on socket %s: %v", s.unixSocket, err)
+		}
+		s.listener = listener
+		return nil
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("error listening on port %d: %v", s.port, err)
+	}
+	s.listener = listener
+	return nil
+}
+
+// Close stops listening. For a Unix domain socket this also removes the
+// socket file.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Start serves the API, binding the port first if Listen was not called.
 func (s *Server) Start() error {
-	http.HandleFunc("/api/track", s.handleTrack)
-	http.HandleFunc("/api/address/", s.handleGetAddress)
-	log.Printf("Starting API server on port %d", s.port)
-	return http.ListenAndServe(fmt.Sprintf(":%d", s.port), nil)
+	if s.listener == nil {
+		if err := s.Listen(); err != nil {
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/track", s.handleTrack)
+	mux.HandleFunc("/api/address/", s.handleAddressRoutes)
+	mux.HandleFunc("/api/transaction/", s.handleTransaction)
+	mux.HandleFunc("/api/block/", s.handleBlock)
+	mux.HandleFunc("/api/balances", s.handleBalances)
+	mux.HandleFunc("/api/notifications/replay", s.handleReplay)
+	mux.HandleFunc("/api/config/export", s.handleConfigExport)
+	mux.HandleFunc("/api/config/import", s.handleConfigImport)
+	mux.HandleFunc("/api/metrics", s.handleMetrics)
+	mux.HandleFunc("/api/stats", s.handleStats)
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/version", s.handleVersion)
+	mux.HandleFunc("/api/capabilities", s.handleCapabilities)
+	mux.HandleFunc("/api/cursor", s.handleCursor)
+	mux.HandleFunc("/api/cursor/rewind", s.handleCursorRewind)
+	mux.HandleFunc("/api/read-only", s.handleReadOnly)
+	log.Printf("Starting API server on %s", s.listener.Addr())
+	err := http.Serve(s.listener, s.rewriteJSON(s.logRequests(mux)))
+	if errors.Is(err, net.ErrClosed) {
+		return nil // stopped by Close
+	}
+	return err
 }
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	const addr = "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1n"
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		ok      bool
+	}{
+		{"canonical", addr, addr, true},
+		{"p2sh", "9rSGfPZLcyCGzY4uYEL1fkzJr6fkicS2rs", "9rSGfPZLcyCGzY4uYEL1fkzJr6fkicS2rs", true},
+		{"leading space", " " + addr, addr, true},
+		{"trailing newline", addr + "\n", addr, true},
+		{"tabs", "\t" + addr + "\t", addr, true},
+		{"empty", "", "", false},
+		{"only whitespace", "  ", "", false},
+		{"inner space", "DTqAFgNNUgiPEfGmc4HZ UkqJ4sz5vADd1n", "", false},
+		{"last character changed", "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1m", "", false},
+		{"two characters swapped", "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADdn1", "", false},
+		{"lowercased", "dtqafgnnugipefgmc4hzukqj4sz5vadd1n", "", false},
+		{"uppercased", "DTQAFGNNUGIPEFGMC4HZUKQJ4SZ5VADD1N", "", false},
+		{"not base58", "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1O", "", false},
+		{"truncated", addr[:len(addr)-1], "", false},
+		{"bitcoin address", "1111111111111111111114oLvT2", "", false},
+		{"testnet address", "nUCAGGgZEPN1QyknmQe1oAku817bQAFKFt", "", false},
+		{"payload too long", "vHGjSxxBdrVmyqonJy34fBwNxh7hUzJMoPE", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeAddress(tt.address)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("normalizeAddress(%q) = %q, %v, want %q, %v", tt.address, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPathParts(t *testing.T) {
+	const addr = "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1n"
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/api/address/" + addr, []string{addr}},
+		{"/api/address/" + addr + "/", []string{addr}},
+		{"/api/address/" + addr + "/history", []string{addr, "history"}},
+		{"/api/address/" + addr + "/history/", []string{addr, "history"}},
+		{"/api/address/" + addr + "/history?interval=day", []string{addr, "history"}},
+		{"/api/address/%20" + addr + "%20/history", []string{" " + addr + " ", "history"}},
+		{"/api/address/%44TqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1n", []string{addr}},
+		{"/api/address/" + addr + "%2Fhistory", []string{addr + "/history"}},
+		{"/api/address/D%C3%A9", []string{"Dé"}},
+		{"/api/address/", []string{""}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if got := pathParts(r, "/api/address/"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pathParts(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	s := &Server{maxBody: 64}
+	tests := []struct {
+		name   string
+		body   string
+		ok     bool
+		status int
+	}{
+		{"within the limit", `{"address": "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1n"}`, true, http.StatusOK},
+		{"oversized", `{"address": "` + strings.Repeat("D", 100) + `"}`, false, http.StatusRequestEntityTooLarge},
+		{"invalid json", `{"address": `, false, http.StatusBadRequest},
+		{"empty", ``, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/api/track", strings.NewReader(tt.body))
+			var req struct {
+				Address string `json:"address"`
+			}
+			if ok := s.decodeBody(w, r, &req); ok != tt.ok {
+				t.Errorf("decodeBody() = %v, want %v", ok, tt.ok)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+// Injection-style input in the address path or a query parameter must be
+// rejected before anything reaches the database (the test server has none)
+func TestInjectionInputsRejected(t *testing.T) {
+	const addr = "DTqAFgNNUgiPEfGmc4HZUkqJ4sz5vADd1n"
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"quote in the address", "/api/address/" + addr + "'%20OR%20'1'='1"},
+		{"statement as the address", "/api/address/'%3B%20DROP%20TABLE%20addresses%3B--/history"},
+		{"comment after the address", "/api/address/" + addr + "--/volume"},
+		{"status", "/api/address/" + addr + "?status=confirmed'%20OR%201=1--"},
+		{"tip_height", "/api/address/" + addr + "?tip_height=1%3B%20DELETE%20FROM%20transactions"},
+		{"limit", "/api/address/" + addr + "?limit=10%20OR%201=1"},
+		{"cursor", "/api/address/" + addr + "?cursor=1-1)%20OR%20(1=1"},
+		{"interval", "/api/address/" + addr + "/history?interval=day'%3B--"},
+		{"window", "/api/address/" + addr + "/volume?window=1%20day'%20OR%20'1'='1"},
+		{"since", "/api/address/" + addr + "/changes?since=0%20OR%201=1"},
+		{"fields", "/api/address/" + addr + "?fields=tx_hash,amount)%20FROM%20addresses--"},
+		{"unit", "/api/address/" + addr + "?unit=doge'--"},
+	}
+	s := &Server{token: "token", jsonCase: SnakeCase}
+	handler := s.rewriteJSON(http.HandlerFunc(s.handleAddressRoutes))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Authorization", "Bearer token")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/dogeorg/dogetracker/pkg/version"
+)
+
+// StatsResponse is returned by /api/stats
+type StatsResponse struct {
+	Addresses AddressStats `json:"addresses"`
+}
+
+type AddressStats struct {
+	Tracked int `json:"tracked"`
+	Max     int `json:"max"` // 0 means unlimited
+}
+
+// handleStats reports usage of the tracker's resource limits
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tracked, err := s.readDB(w).CountTrackedAddresses()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, StatsResponse{
+		Addresses: AddressStats{Tracked: tracked, Max: s.maxAddresses},
+	})
+}
+
+// handleVersion reports the build of the running tracker
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, version.Get())
+}
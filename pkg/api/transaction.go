@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxNoteLength = 1000
+
+// isValidTxID checks for a 64 character hex transaction id
+func isValidTxID(txid string) bool {
+	if len(txid) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(txid)
+	return err == nil
+}
+
+// tipHeight parses the optional ?tip_height= parameter: a client's own chain
+// tip to compute confirmations against instead of the tracker's.
+func tipHeight(r *http.Request) (tip int64, ok bool, err error) {
+	value := r.URL.Query().Get("tip_height")
+	if value == "" {
+		return 0, false, nil
+	}
+	tip, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || tip < 0 {
+		return 0, false, strconv.ErrSyntax
+	}
+	return tip, true, nil
+}
+
+// confirmationsAt returns the confirmations of a transaction at blockHeight
+// as seen from tip; 0 if the block is above the tip.
+func confirmationsAt(tip, blockHeight int64) int {
+	if blockHeight > tip {
+		return 0
+	}
+	return int(tip - blockHeight + 1)
+}
+
+// handleTransaction routes /api/transaction/{txid}/... sub-resources
+func (s *Server) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Split "{txid}/{resource}"
+	parts := pathParts(r, "/api/transaction/")
+	txid := strings.ToLower(parts[0])
+	if !isValidTxID(txid) {
+		http.Error(w, "Invalid transaction id", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.handleTransactionDetail(w, r, txid)
+	case len(parts) == 2 && parts[1] == "note":
+		s.handleTransactionNote(w, r, txid)
+	case len(parts) == 2 && parts[1] == "addresses":
+		s.handleTransactionAddresses(w, r, txid)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleTransactionDetail returns every tracked address's record of a
+// transaction, including archived ones
+func (s *Server) handleTransactionDetail(w http.ResponseWriter, r *http.Request, txid string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tip, useTip, err := tipHeight(r)
+	if err != nil {
+		http.Error(w, "Invalid tip_height", http.StatusBadRequest)
+		return
+	}
+	details, err := s.readDB(w).GetTransactionsByHash(txid)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(details) == 0 {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if useTip {
+		for i := range details {
+			details[i].Confirmations = confirmationsAt(tip, details[i].BlockHeight)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, details)
+}
+
+// handleTransactionAddresses returns just the tracked addresses a
+// transaction touched, and the direction for each
+func (s *Server) handleTransactionAddresses(w http.ResponseWriter, r *http.Request, txid string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	addresses, err := s.readDB(w).GetTransactionAddresses(txid)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(addresses) == 0 {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, addresses)
+}
+
+// handleTransactionNote attaches (POST) or lists (GET) the notes on a
+// transaction. Notes are scoped to one tracked address.
+func (s *Server) handleTransactionNote(w http.ResponseWriter, r *http.Request, txid string) {
+	switch r.Method {
+	case http.MethodGet:
+		address, ok := normalizeAddress(r.URL.Query().Get("address"))
+		if !ok {
+			http.Error(w, "Invalid address", http.StatusBadRequest)
+			return
+		}
+		notes, err := s.db.GetTransactionNotes(address, txid)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		s.writeJSON(w, r, notes)
+
+	case http.MethodPost:
+		if s.rejectWrite(w) {
+			return
+		}
+		var req struct {
+			Address string `json:"address"`
+			Note    string `json:"note"`
+		}
+		if !s.decodeBody(w, r, &req) {
+			return
+		}
+		address, ok := normalizeAddress(req.Address)
+		if !ok {
+			http.Error(w, "Invalid address", http.StatusBadRequest)
+			return
+		}
+		req.Note = strings.TrimSpace(req.Note)
+		if req.Note == "" || len(req.Note) > maxNoteLength {
+			http.Error(w, "Note must be 1 to 1000 characters", http.StatusBadRequest)
+			return
+		}
+		note, err := s.db.AddTransactionNote(address, txid, req.Note)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if note == nil {
+			http.Error(w, "Transaction not found for address", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		s.writeJSON(w, r, note)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
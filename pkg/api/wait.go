@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+const (
+	maxWaiters     = 100
+	defaultWait    = 30 * time.Second
+	maxWait        = 120 * time.Second
+	defaultMinConf = 1
+)
+
+/*
+ * confirmationsSignal wakes long-poll waiters whenever the block processor
+ * finishes a confirmation pass. Each pass closes the current channel and
+ * replaces it, so every waiter blocked on it wakes exactly once.
+ */
+type confirmationsSignal struct {
+	lock    sync.Mutex
+	updated chan struct{}
+}
+
+func newConfirmationsSignal() *confirmationsSignal {
+	return &confirmationsSignal{updated: make(chan struct{})}
+}
+
+func (c *confirmationsSignal) wait() <-chan struct{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.updated
+}
+
+func (c *confirmationsSignal) broadcast() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	close(c.updated)
+	c.updated = make(chan struct{})
+}
+
+// ConfirmationsUpdated is called by the block processor after each
+// confirmation pass, to wake long-poll waiters.
+func (s *Server) ConfirmationsUpdated() {
+	s.confirmations.broadcast()
+}
+
+type WaitResponse struct {
+	Reached     bool                        `json:"reached"` // confirmations >= min_conf
+	MinConf     int                         `json:"min_conf"`
+	Transaction *database.TransactionDetail `json:"transaction"` // null if not seen yet
+}
+
+// handleWait blocks until txid reaches min_conf confirmations for the
+// address, or the timeout elapses, then returns the current state.
+// GET /api/address/{addr}/wait?txid=X&min_conf=N&timeout=30s
+func (s *Server) handleWait(w http.ResponseWriter, r *http.Request, address string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	txid := strings.ToLower(query.Get("txid"))
+	if !isValidTxID(txid) {
+		http.Error(w, "Invalid txid", http.StatusBadRequest)
+		return
+	}
+	minConf := defaultMinConf
+	if v := query.Get("min_conf"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid min_conf", http.StatusBadRequest)
+			return
+		}
+		minConf = n
+	}
+	timeout := defaultWait
+	if v := query.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxWait {
+			http.Error(w, "Invalid timeout (maximum 120s)", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	// Bound concurrent waiters
+	select {
+	case s.waiters <- struct{}{}:
+		defer func() { <-s.waiters }()
+	default:
+		http.Error(w, "Too many waiting requests", http.StatusServiceUnavailable)
+		return
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	var response WaitResponse
+	response.MinConf = minConf
+	for {
+		// Subscribe before reading, so an update between the read and the wait is not missed
+		updated := s.confirmations.wait()
+		tx, err := s.db.GetAddressTransaction(address, txid)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		response.Transaction = tx
+		response.Reached = tx != nil && tx.Confirmations >= minConf
+		if response.Reached {
+			break
+		}
+		select {
+		case <-updated:
+			continue
+		case <-deadline.C:
+			// timed out: return the current state
+		case <-r.Context().Done():
+			return
+		}
+		break
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeJSON(w, r, response)
+}
@@ -0,0 +1,167 @@
+package coinselect
+
+import (
+	"errors"
+	"sort"
+)
+
+// Amounts are in koinu (1 DOGE = 100,000,000 koinu) to avoid float rounding.
+const KoinuPerDoge = 100_000_000
+
+// MaxMoney is the largest amount a transaction may move (Dogecoin Core's
+// MAX_MONEY, 10 billion DOGE).
+const MaxMoney = 10_000_000_000 * KoinuPerDoge
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// UTXO is a spendable output: output Vout of transaction TxHash.
+type UTXO struct {
+	TxHash string
+	Vout   int
+	Amount int64
+}
+
+// Selection is the set of inputs chosen to fund a target amount.
+type Selection struct {
+	Strategy string
+	Inputs   []UTXO
+	Total    int64
+	Change   int64 // Total - target (for a changeless bnb match, the excess goes to fees)
+}
+
+// Strategy selects inputs that add up to at least target.
+type Strategy interface {
+	Name() string
+	Select(utxos []UTXO, target int64) (Selection, error)
+}
+
+// Strategies available by name (e.g. from a query parameter).
+var Strategies = map[string]Strategy{
+	"largest-first": LargestFirst{},
+	"bnb":           BranchAndBound{CostOfChange: DefaultCostOfChange, MaxTries: DefaultMaxTries},
+}
+
+func newSelection(name string, inputs []UTXO, target int64) Selection {
+	var total int64
+	for _, u := range inputs {
+		total += u.Amount
+	}
+	return Selection{Strategy: name, Inputs: inputs, Total: total, Change: total - target}
+}
+
+// sortedDesc returns a copy of utxos sorted by amount, largest first
+// (ties broken by txid and output index so results are deterministic).
+func sortedDesc(utxos []UTXO) []UTXO {
+	sorted := make([]UTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Amount != sorted[j].Amount {
+			return sorted[i].Amount > sorted[j].Amount
+		}
+		if sorted[i].TxHash != sorted[j].TxHash {
+			return sorted[i].TxHash < sorted[j].TxHash
+		}
+		return sorted[i].Vout < sorted[j].Vout
+	})
+	return sorted
+}
+
+/*
+ * LargestFirst adds the largest outputs until the target is covered.
+ * Uses few inputs, but almost always produces change.
+ */
+type LargestFirst struct{}
+
+func (LargestFirst) Name() string { return "largest-first" }
+
+func (s LargestFirst) Select(utxos []UTXO, target int64) (Selection, error) {
+	var inputs []UTXO
+	var total int64
+	for _, u := range sortedDesc(utxos) {
+		if total >= target {
+			break
+		}
+		inputs = append(inputs, u)
+		total += u.Amount
+	}
+	if total < target {
+		return Selection{}, ErrInsufficientFunds
+	}
+	return newSelection(s.Name(), inputs, target), nil
+}
+
+const (
+	DefaultCostOfChange = 1 * KoinuPerDoge // an exact match may overshoot by up to 1 DOGE
+	DefaultMaxTries     = 100_000
+)
+
+/*
+ * BranchAndBound searches for a set of inputs whose total lands in
+ * [target, target+CostOfChange], i.e. needs no change output (better
+ * privacy, no dust change). Depth-first over outputs sorted largest first,
+ * pruning branches that overshoot or can no longer reach the target.
+ * Falls back to LargestFirst when no such set is found within MaxTries.
+ */
+type BranchAndBound struct {
+	CostOfChange int64
+	MaxTries     int
+}
+
+func (BranchAndBound) Name() string { return "bnb" }
+
+func (s BranchAndBound) Select(utxos []UTXO, target int64) (Selection, error) {
+	sorted := sortedDesc(utxos)
+
+	// remaining[i] = sum of sorted[i:], for pruning branches that cannot reach target
+	remaining := make([]int64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Amount
+	}
+	if remaining[0] < target {
+		return Selection{}, ErrInsufficientFunds
+	}
+
+	upper := target + s.CostOfChange
+	var best []int
+	bestWaste := int64(-1)
+	tries := 0
+	chosen := make([]int, 0, len(sorted))
+
+	var search func(i int, total int64)
+	search = func(i int, total int64) {
+		tries++
+		if tries > s.MaxTries || total > upper || total+remaining[i] < target {
+			return
+		}
+		if total >= target {
+			if waste := total - target; bestWaste < 0 || waste < bestWaste {
+				bestWaste = waste
+				best = append(best[:0], chosen...)
+			}
+			return
+		}
+		if i == len(sorted) {
+			return
+		}
+		// include sorted[i], then exclude it
+		chosen = append(chosen, i)
+		search(i+1, total+sorted[i].Amount)
+		chosen = chosen[:len(chosen)-1]
+		if bestWaste == 0 {
+			return // exact match, cannot do better
+		}
+		search(i+1, total)
+	}
+	search(0, 0)
+
+	if bestWaste < 0 {
+		selection, err := LargestFirst{}.Select(utxos, target)
+		selection.Strategy = "largest-first (bnb found no changeless match)"
+		return selection, err
+	}
+	inputs := make([]UTXO, len(best))
+	for i, idx := range best {
+		inputs[i] = sorted[idx]
+	}
+	return newSelection(s.Name(), inputs, target), nil
+}
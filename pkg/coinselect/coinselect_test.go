@@ -0,0 +1,132 @@
+package coinselect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func utxo(txHash string, vout int, doge float64) UTXO {
+	return UTXO{TxHash: txHash, Vout: vout, Amount: int64(doge * KoinuPerDoge)}
+}
+
+func inputIDs(inputs []UTXO) []string {
+	ids := make([]string, len(inputs))
+	for i, in := range inputs {
+		ids[i] = in.TxHash + ":" + string(rune('0'+in.Vout))
+	}
+	return ids
+}
+
+func TestStrategies(t *testing.T) {
+	bnb := BranchAndBound{CostOfChange: DefaultCostOfChange, MaxTries: DefaultMaxTries}
+	tests := []struct {
+		name   string
+		utxos  []UTXO
+		target float64
+
+		lfInputs    []string
+		lfChange    float64
+		bnbStrategy string
+		bnbInputs   []string
+		bnbChange   float64
+	}{
+		{
+			name:        "bnb finds an exact match largest-first overshoots",
+			utxos:       []UTXO{utxo("a", 0, 100), utxo("b", 0, 50), utxo("c", 1, 30), utxo("d", 2, 20)},
+			target:      70,
+			lfInputs:    []string{"a:0"},
+			lfChange:    30,
+			bnbStrategy: "bnb",
+			bnbInputs:   []string{"b:0", "d:2"},
+			bnbChange:   0,
+		},
+		{
+			name:        "bnb combines smaller outputs to avoid change",
+			utxos:       []UTXO{utxo("a", 0, 80), utxo("b", 0, 45), utxo("c", 0, 30), utxo("d", 0, 26)},
+			target:      75,
+			lfInputs:    []string{"a:0"},
+			lfChange:    5,
+			bnbStrategy: "bnb",
+			bnbInputs:   []string{"b:0", "c:0"},
+			bnbChange:   0,
+		},
+		{
+			name:        "bnb accepts an overshoot within the cost of change",
+			utxos:       []UTXO{utxo("a", 0, 60.5), utxo("b", 0, 30), utxo("c", 0, 10)},
+			target:      60,
+			lfInputs:    []string{"a:0"},
+			lfChange:    0.5,
+			bnbStrategy: "bnb",
+			bnbInputs:   []string{"a:0"},
+			bnbChange:   0.5,
+		},
+		{
+			name:        "bnb falls back to largest-first without a changeless match",
+			utxos:       []UTXO{utxo("a", 0, 100), utxo("b", 0, 40)},
+			target:      50,
+			lfInputs:    []string{"a:0"},
+			lfChange:    50,
+			bnbStrategy: "largest-first (bnb found no changeless match)",
+			bnbInputs:   []string{"a:0"},
+			bnbChange:   50,
+		},
+		{
+			name:        "equal amounts are ordered by txid and output index",
+			utxos:       []UTXO{utxo("b", 0, 10), utxo("a", 1, 10), utxo("a", 0, 10)},
+			target:      15,
+			lfInputs:    []string{"a:0", "a:1"},
+			lfChange:    5,
+			bnbStrategy: "largest-first (bnb found no changeless match)",
+			bnbInputs:   []string{"a:0", "a:1"},
+			bnbChange:   5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := int64(tt.target * KoinuPerDoge)
+
+			lf, err := LargestFirst{}.Select(tt.utxos, target)
+			if err != nil {
+				t.Fatalf("largest-first: %v", err)
+			}
+			if got := inputIDs(lf.Inputs); !reflect.DeepEqual(got, tt.lfInputs) {
+				t.Errorf("largest-first inputs = %v, want %v", got, tt.lfInputs)
+			}
+			if want := int64(tt.lfChange * KoinuPerDoge); lf.Change != want {
+				t.Errorf("largest-first change = %d, want %d", lf.Change, want)
+			}
+
+			sel, err := bnb.Select(tt.utxos, target)
+			if err != nil {
+				t.Fatalf("bnb: %v", err)
+			}
+			if sel.Strategy != tt.bnbStrategy {
+				t.Errorf("bnb strategy = %q, want %q", sel.Strategy, tt.bnbStrategy)
+			}
+			if got := inputIDs(sel.Inputs); !reflect.DeepEqual(got, tt.bnbInputs) {
+				t.Errorf("bnb inputs = %v, want %v", got, tt.bnbInputs)
+			}
+			if want := int64(tt.bnbChange * KoinuPerDoge); sel.Change != want {
+				t.Errorf("bnb change = %d, want %d", sel.Change, want)
+			}
+			if sel.Total-sel.Change != target || lf.Total-lf.Change != target {
+				t.Errorf("total - change does not equal the target")
+			}
+			if sel.Change > lf.Change {
+				t.Errorf("bnb change %d is more than largest-first's %d", sel.Change, lf.Change)
+			}
+		})
+	}
+}
+
+func TestInsufficientFunds(t *testing.T) {
+	utxos := []UTXO{utxo("a", 0, 10), utxo("b", 0, 20)}
+	for name, strategy := range Strategies {
+		if _, err := strategy.Select(utxos, 31*KoinuPerDoge); err != ErrInsufficientFunds {
+			t.Errorf("%s: err = %v, want ErrInsufficientFunds", name, err)
+		}
+		if _, err := strategy.Select(nil, 1); err != ErrInsufficientFunds {
+			t.Errorf("%s with no outputs: err = %v, want ErrInsufficientFunds", name, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned without calling the node while the circuit
+// breaker is open.
+var ErrBreakerOpen = errors.New("node RPC circuit breaker open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // calls go through
+	BreakerOpen     = "open"      // calls fail fast until the cooldown ends
+	BreakerHalfOpen = "half-open" // one probe call is in flight
+)
+
+// CircuitBreaker sheds load from a distressed node: after threshold
+// consecutive failures it opens and fails every call fast for cooldown,
+// then lets a single probe call through. A successful probe closes it
+// again, a failed one re-opens it for another cooldown.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int       // consecutive failures
+	openedAt time.Time // when the breaker last opened
+}
+
+// NewCircuitBreaker returns a closed breaker.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// allow reports whether a call may go to the node.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrBreakerOpen
+		}
+		// Cooldown over: this call is the probe
+		b.state = BreakerHalfOpen
+		return nil
+	case BreakerHalfOpen:
+		return ErrBreakerOpen // wait for the probe's outcome
+	}
+	return nil
+}
+
+// record feeds the outcome of an allowed call back into the breaker.
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Status returns the breaker state, the number of consecutive failures and,
+// while open, when the next probe will be let through.
+func (b *CircuitBreaker) Status() (state string, failures int, retryAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		retryAt = b.openedAt.Add(b.cooldown)
+	}
+	return b.state, b.failures, retryAt
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+// GetMerkleProof returns the merkle branch proving that txid is included
+// in the block at height, along with the block's serialized header.
+func (c *CoreRPCClient) GetMerkleProof(txid string, height int64) (spec.MerkleProof, error) {
+	hash, err := c.GetBlockHash(height)
+	if err != nil {
+		return spec.MerkleProof{}, fmt.Errorf("error getting block hash: %v", err)
+	}
+
+	// Block with txids only (verbosity=1)
+	var block struct {
+		MerkleRoot string   `json:"merkleroot"`
+		Tx         []string `json:"tx"`
+	}
+	if err := c.Request("getblock", []any{hash, 1}, &block); err != nil {
+		return spec.MerkleProof{}, fmt.Errorf("error getting block data: %v", err)
+	}
+	var header string
+	if err := c.Request("getblockheader", []any{hash, false}, &header); err != nil {
+		return spec.MerkleProof{}, fmt.Errorf("error getting block header: %v", err)
+	}
+
+	index := -1
+	for i, id := range block.Tx {
+		if id == txid {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return spec.MerkleProof{}, fmt.Errorf("transaction %s not in block %s", txid, hash)
+	}
+
+	branch, root, err := merkleBranch(block.Tx, index)
+	if err != nil {
+		return spec.MerkleProof{}, err
+	}
+	if root != block.MerkleRoot {
+		return spec.MerkleProof{}, fmt.Errorf("computed merkle root %s does not match block %s", root, hash)
+	}
+	return spec.MerkleProof{
+		TxID:        txid,
+		BlockHash:   hash,
+		BlockHeight: height,
+		Header:      header,
+		Index:       index,
+		Branch:      branch,
+		MerkleRoot:  root,
+	}, nil
+}
+
+// merkleBranch returns the sibling hashes on the path from the transaction
+// at index to the merkle root, and the root itself. Hashes are in display
+// (byte-reversed) hex, like txids; an odd hash at any level is paired with
+// itself, as in Core.
+func merkleBranch(txids []string, index int) (branch []string, root string, err error) {
+	level := make([][]byte, len(txids))
+	for i, id := range txids {
+		b, err := hex.DecodeString(id)
+		if err != nil || len(b) != 32 {
+			return nil, "", fmt.Errorf("invalid txid %q", id)
+		}
+		level[i] = reverse(b)
+	}
+
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, hex.EncodeToString(reverse(level[index^1])))
+
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			first := sha256.Sum256(append(append([]byte{}, level[2*i]...), level[2*i+1]...))
+			second := sha256.Sum256(first[:])
+			next[i] = second[:]
+		}
+		level = next
+		index /= 2
+	}
+	return branch, hex.EncodeToString(reverse(level[0])), nil
+}
+
+// reverse returns a byte-reversed copy of b
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
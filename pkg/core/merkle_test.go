@@ -0,0 +1,86 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// Bitcoin block 100000: the same merkle tree construction as Dogecoin's
+var block100000 = []string{
+	"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+	"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+	"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+	"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+}
+
+const block100000Root = "f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766"
+
+// foldBranch hashes txid up the branch, as a client checking a proof would
+func foldBranch(t *testing.T, txid string, index int, branch []string) string {
+	t.Helper()
+	hash, err := hex.DecodeString(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash = reverse(hash)
+	for _, sibling := range branch {
+		s, err := hex.DecodeString(sibling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = reverse(s)
+		var pair []byte
+		if index&1 == 1 {
+			pair = append(s, hash...)
+		} else {
+			pair = append(hash, s...)
+		}
+		first := sha256.Sum256(pair)
+		second := sha256.Sum256(first[:])
+		hash = second[:]
+		index /= 2
+	}
+	return hex.EncodeToString(reverse(hash))
+}
+
+func TestMerkleBranch(t *testing.T) {
+	tests := []struct {
+		name  string
+		txids []string
+		root  string // empty to only check the branches fold to the computed root
+	}{
+		{"single transaction", block100000[:1], block100000[0]},
+		{"block 100000", block100000, block100000Root},
+		{"odd number of transactions", block100000[:3], ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for index, txid := range tt.txids {
+				branch, root, err := merkleBranch(tt.txids, index)
+				if err != nil {
+					t.Fatalf("merkleBranch(%d): %v", index, err)
+				}
+				if tt.root != "" && root != tt.root {
+					t.Errorf("merkleBranch(%d) root = %s, want %s", index, root, tt.root)
+				}
+				if got := foldBranch(t, txid, index, branch); got != root {
+					t.Errorf("branch for %d folds to %s, want %s", index, got, root)
+				}
+				// A different transaction must not prove against the same branch
+				other := tt.txids[(index+1)%len(tt.txids)]
+				if other != txid && foldBranch(t, other, index, branch) == root {
+					t.Errorf("branch for %d also proves %s", index, other)
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleBranchInvalidTxid(t *testing.T) {
+	for _, txid := range []string{"", "zz", block100000[0][:62]} {
+		if _, _, err := merkleBranch([]string{block100000[0], txid}, 0); err == nil {
+			t.Errorf("merkleBranch with txid %q: want an error", txid)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/golangcrypto/scrypt"
+	"github.com/dogeorg/doge"
+)
+
+// VerifyBlockPoW fetches a block and checks that its header hashes to hash
+// and that its Scrypt proof of work meets the target encoded in its bits.
+// For merge-mined (AuxPoW) blocks the parent block's header is checked
+// instead; the AuxPoW merkle branches linking it to the block are not.
+func (c *CoreRPCClient) VerifyBlockPoW(hash string) error {
+	raw, err := c.GetBlock(hash)
+	if err != nil {
+		return fmt.Errorf("error getting block: %v", err)
+	}
+	block, err := hex.DecodeString(raw)
+	if err != nil {
+		return fmt.Errorf("invalid block hex: %v", err)
+	}
+	return verifyPoW(hash, block)
+}
+
+// verifyPoW checks the proof of work of a serialized block
+func verifyPoW(hash string, block []byte) error {
+	header, err := rawBlockHash(block)
+	if err != nil {
+		return err
+	}
+	if header != hash {
+		return fmt.Errorf("block %s has a header hashing to %s", hash, header)
+	}
+
+	bits := binary.LittleEndian.Uint32(block[72:76])
+	target := compactToBig(bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("block %s has invalid bits %08x", hash, bits)
+	}
+
+	powHeader := block[:80]
+	if binary.LittleEndian.Uint32(block[0:4])&doge.VersionAuxPoW != 0 {
+		powHeader, err = auxPoWParentHeader(block)
+		if err != nil {
+			return fmt.Errorf("block %s: %v", hash, err)
+		}
+	}
+	powHash, err := scrypt.Key(powHeader, powHeader, 1024, 1, 1, 32)
+	if err != nil {
+		return err
+	}
+	if new(big.Int).SetBytes(reverse(powHash)).Cmp(target) > 0 {
+		return fmt.Errorf("block %s does not meet its proof-of-work target", hash)
+	}
+	return nil
+}
+
+// auxPoWParentHeader returns the serialized header of the parent block that
+// carries a merge-mined block's proof of work
+func auxPoWParentHeader(block []byte) (header []byte, err error) {
+	// DecodeBlock panics on truncated data
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("malformed AuxPoW block")
+		}
+	}()
+	decoded := doge.DecodeBlock(block)
+	if decoded.AuxPoW == nil {
+		return nil, fmt.Errorf("missing AuxPoW data")
+	}
+	parent := decoded.AuxPoW.ParentBlock
+	header = make([]byte, 80)
+	binary.LittleEndian.PutUint32(header[0:4], parent.Version)
+	copy(header[4:36], parent.PrevBlock)
+	copy(header[36:68], parent.MerkleRoot)
+	binary.LittleEndian.PutUint32(header[68:72], parent.Timestamp)
+	binary.LittleEndian.PutUint32(header[72:76], parent.Bits)
+	binary.LittleEndian.PutUint32(header[76:80], parent.Nonce)
+	return header, nil
+}
+
+// compactToBig decodes the compact target representation used in block
+// headers' bits field
+func compactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+	var n *big.Int
+	if exponent <= 3 {
+		n = big.NewInt(mantissa >> (8 * (3 - exponent)))
+	} else {
+		n = new(big.Int).Lsh(big.NewInt(mantissa), 8*(exponent-3))
+	}
+	if bits&0x00800000 != 0 {
+		n.Neg(n)
+	}
+	return n
+}
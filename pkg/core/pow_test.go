@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// Dogecoin's genesis block
+const genesisHash = "1a91e3dace36e2be3bf030a65679fe821aa1d6ef92e7c9902eb318182c355691"
+
+// genesisHeader returns the genesis block header with the given bits and nonce
+func genesisHeader(t *testing.T, bits, nonce uint32) []byte {
+	t.Helper()
+	merkleRoot, err := hex.DecodeString("5b2a3f53f605d62c53e62932dac6925e3d74afa5a4b459745c36d42d0ed26a69")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 80)
+	binary.LittleEndian.PutUint32(header[0:4], 1)
+	copy(header[36:68], reverse(merkleRoot))
+	binary.LittleEndian.PutUint32(header[68:72], 1386325540)
+	binary.LittleEndian.PutUint32(header[72:76], bits)
+	binary.LittleEndian.PutUint32(header[76:80], nonce)
+	return header
+}
+
+func TestVerifyPoW(t *testing.T) {
+	const bits, nonce = 0x1e0ffff0, 99943
+	tests := []struct {
+		name  string
+		block func(t *testing.T) []byte
+		hash  func(block []byte) string // defaults to the block's own hash
+		ok    bool
+	}{
+		{
+			name:  "genesis block",
+			block: func(t *testing.T) []byte { return genesisHeader(t, bits, nonce) },
+			hash:  func([]byte) string { return genesisHash },
+			ok:    true,
+		},
+		{
+			name:  "header not matching the hash",
+			block: func(t *testing.T) []byte { return genesisHeader(t, bits, nonce+1) },
+			hash:  func([]byte) string { return genesisHash },
+		},
+		{
+			name:  "proof of work above the target",
+			block: func(t *testing.T) []byte { return genesisHeader(t, bits, nonce+1) },
+		},
+		{
+			name:  "target lowered below the proof of work",
+			block: func(t *testing.T) []byte { return genesisHeader(t, 0x1d00ffff, nonce) },
+		},
+		{
+			name:  "negative target",
+			block: func(t *testing.T) []byte { return genesisHeader(t, 0x1e8ffff0, nonce) },
+		},
+		{
+			name:  "zero target",
+			block: func(t *testing.T) []byte { return genesisHeader(t, 0x1e000000, nonce) },
+		},
+		{
+			name:  "truncated header",
+			block: func(t *testing.T) []byte { return genesisHeader(t, bits, nonce)[:79] },
+			hash:  func([]byte) string { return genesisHash },
+		},
+		{
+			name: "auxpow flag without auxpow data",
+			block: func(t *testing.T) []byte {
+				header := genesisHeader(t, bits, nonce)
+				binary.LittleEndian.PutUint32(header[0:4], 0x00620102)
+				return header
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := tt.block(t)
+			hash := displayHash(block[:len(block)/80*80])
+			if tt.hash != nil {
+				hash = tt.hash(block)
+			}
+			err := verifyPoW(hash, block)
+			if tt.ok && err != nil {
+				t.Errorf("verifyPoW() = %v, want nil", err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("verifyPoW() = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string // hex
+	}{
+		{0x1e0ffff0, "ffff0" + "000000000000000000000000000000000000000000000000000000"},
+		{0x1d00ffff, "ffff" + "0000000000000000000000000000000000000000000000000000"},
+		{0x03123456, "123456"},
+		{0x02123456, "1234"},
+		{0x01123456, "12"},
+		{0x00000000, "0"},
+		{0x04923456, "-12345600"},
+	}
+	for _, tt := range tests {
+		if got := compactToBig(tt.bits).Text(16); got != tt.want {
+			t.Errorf("compactToBig(%08x) = %s, want %s", tt.bits, got, tt.want)
+		}
+	}
+}
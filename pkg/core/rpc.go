@@ -3,30 +3,58 @@ package core
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/dogeorg/dogetracker/pkg/spec"
 )
 
+// rpcTimeout bounds a single RPC call, so a stalled node counts as a failure
+const rpcTimeout = 60 * time.Second
+
+// rpcMaxIdleConns is how many connections to the node are kept open for
+// reuse, enough for concurrent callers (-shards) without reconnecting.
+// Core queues calls beyond its -rpcthreads (default 4).
+const rpcMaxIdleConns = 16
+
 // NewCoreRPCClient returns a Dogecoin Core Node client.
-// Thread-safe, can be shared across Goroutines.
-func NewCoreRPCClient(rpcHost string, rpcPort int, rpcUser string, rpcPass string) spec.Blockchain {
+// Thread-safe, can be shared across Goroutines: their calls go to the
+// node concurrently.
+// breaker may be nil to always call the node.
+func NewCoreRPCClient(rpcHost string, rpcPort int, rpcUser string, rpcPass string, breaker *CircuitBreaker) *CoreRPCClient {
 	url := fmt.Sprintf("http://%s:%d", rpcHost, rpcPort)
-	return &CoreRPCClient{url: url, user: rpcUser, pass: rpcPass}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = rpcMaxIdleConns
+	return &CoreRPCClient{
+		url:     url,
+		user:    rpcUser,
+		pass:    rpcPass,
+		client:  &http.Client{Timeout: rpcTimeout, Transport: transport},
+		breaker: breaker,
+	}
 }
 
 type CoreRPCClient struct {
-	url  string
-	user string
-	pass string
-	id   atomic.Uint64 // next unique request id
-	lock sync.Mutex
+	url     string
+	user    string
+	pass    string
+	client  *http.Client
+	breaker *CircuitBreaker
+	id      atomic.Uint64 // next unique request id, so concurrent calls need no lock
+
+	// The verbose block last looked up, shared by every address's lookup
+	// in it (concurrent ones too, with -shards)
+	blockMu sync.Mutex
+	block   *cachedBlock
 }
 
+var _ spec.Blockchain = (*CoreRPCClient)(nil)
+
 func (c *CoreRPCClient) GetBlockHeader(blockHash string) (txn spec.BlockHeader, err error) {
 	decode := true // to get back JSON rather than HEX
 	err = c.Request("getblockheader", []any{blockHash, decode}, &txn)
@@ -61,110 +89,203 @@ func (c *CoreRPCClient) GetAddressTransactions(address string, height int64) ([]
 		return nil, fmt.Errorf("error getting block hash: %v", err)
 	}
 
-	// Get block with transactions
-	var block struct {
-		Tx []struct {
-			Txid string `json:"txid"`
-			Vin  []struct {
-				Txid string `json:"txid"`
-				Vout int    `json:"vout"`
-			} `json:"vin"`
-			Vout []struct {
-				Value        float64 `json:"value"`
-				ScriptPubKey struct {
-					Addresses []string `json:"addresses"`
-				} `json:"scriptPubKey"`
-			} `json:"vout"`
-		} `json:"tx"`
-	}
-
-	// Get block with transaction details (verbosity=2)
-	err = c.Request("getblock", []any{hash, 2}, &block)
+	// Get block with transaction details (verbosity=2), once per block
+	block, err := c.cachedBlock(hash)
 	if err != nil {
 		return nil, fmt.Errorf("error getting block data: %v", err)
 	}
 
+	return addressTransactions(block.block, address, func(txid string, vout int) ([]string, error) {
+		return c.cachedPrevOut(block, txid, vout)
+	})
+}
+
+// cachedBlock is a verbose block and the outputs its inputs spent, looked
+// up once for all tracked addresses. It is keyed by hash, so a block
+// replaced by a reorg is fetched again.
+type cachedBlock struct {
+	hash  string
+	block verboseBlock
+
+	mu      sync.Mutex
+	prevOut map[string]*prevOutLookup // by spent txid
+}
+
+// prevOutLookup is one getrawtransaction call, made by the first address
+// that needs it while the others wait for its result
+type prevOutLookup struct {
+	once    sync.Once
+	outputs [][]string // addresses of each output
+	err     error
+}
+
+// cachedBlock returns the verbose block with the given hash, asking the node
+// only if it is not the block last looked up
+func (c *CoreRPCClient) cachedBlock(hash string) (*cachedBlock, error) {
+	c.blockMu.Lock()
+	defer c.blockMu.Unlock()
+	if c.block != nil && c.block.hash == hash {
+		return c.block, nil
+	}
+	block := &cachedBlock{hash: hash, prevOut: make(map[string]*prevOutLookup)}
+	if err := c.Request("getblock", []any{hash, 2}, &block.block); err != nil {
+		return nil, err
+	}
+	c.block = block
+	return block, nil
+}
+
+// cachedPrevOut returns the addresses output vout of txid paid to, asking
+// the node about each spent transaction once per block. A failed lookup is
+// kept like a successful one, as every address would skip the output
+// anyway, except when the circuit breaker is open: the block is retried
+// and so is the lookup.
+func (c *CoreRPCClient) cachedPrevOut(block *cachedBlock, txid string, vout int) ([]string, error) {
+	block.mu.Lock()
+	lookup, ok := block.prevOut[txid]
+	if !ok {
+		lookup = &prevOutLookup{}
+		block.prevOut[txid] = lookup
+	}
+	block.mu.Unlock()
+
+	lookup.once.Do(func() {
+		lookup.outputs, lookup.err = c.prevOutputs(txid)
+	})
+	if errors.Is(lookup.err, ErrBreakerOpen) {
+		block.mu.Lock()
+		if block.prevOut[txid] == lookup {
+			delete(block.prevOut, txid)
+		}
+		block.mu.Unlock()
+	}
+	if lookup.err != nil {
+		return nil, lookup.err
+	}
+	if vout >= len(lookup.outputs) {
+		return nil, nil
+	}
+	return lookup.outputs[vout], nil
+}
+
+// verboseBlock is the part of getblock's verbosity=2 result the tracker reads
+type verboseBlock struct {
+	Tx []verboseTx `json:"tx"`
+}
+
+type verboseTx struct {
+	Txid  string `json:"txid"`
+	Size  int    `json:"size"`
+	VSize int    `json:"vsize"`
+	Vin   []struct {
+		Txid string `json:"txid"`
+		Vout int    `json:"vout"`
+	} `json:"vin"`
+	Vout []struct {
+		Value        spec.Amount `json:"value"`
+		ScriptPubKey struct {
+			Hex       string   `json:"hex"`
+			Type      string   `json:"type"`
+			Addresses []string `json:"addresses"`
+		} `json:"scriptPubKey"`
+	} `json:"vout"`
+}
+
+// prevOutputs returns the addresses each output of txid paid to
+func (c *CoreRPCClient) prevOutputs(txid string) ([][]string, error) {
+	var prevTx struct {
+		Vout []struct {
+			ScriptPubKey struct {
+				Addresses []string `json:"addresses"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+	}
+	if err := c.Request("getrawtransaction", []any{txid, 1}, &prevTx); err != nil {
+		return nil, err
+	}
+	outputs := make([][]string, len(prevTx.Vout))
+	for i, out := range prevTx.Vout {
+		outputs[i] = out.ScriptPubKey.Addresses
+	}
+	return outputs, nil
+}
+
+// addressTransactions returns address's outputs and spends in a block, in
+// block order: an output created by one transaction comes before its spend
+// by a later one. Spent outputs created earlier in the same block are
+// resolved from the block itself, others with prevOut. An output prevOut
+// fails to look up is skipped, unless the circuit breaker is open.
+func addressTransactions(block verboseBlock, address string, prevOut func(txid string, vout int) ([]string, error)) ([]spec.Transaction, error) {
 	var transactions []spec.Transaction
 
+	// Outputs of the transactions seen so far, by txid
+	created := make(map[string]*verboseTx, len(block.Tx))
+
 	// Process each transaction in the block
-	for _, tx := range block.Tx {
+	for i := range block.Tx {
+		tx := &block.Tx[i]
+
+		// vsize equals size for non-witness transactions
+		vsize := tx.VSize
+		if vsize == 0 {
+			vsize = tx.Size
+		}
+
 		// Check if this transaction spends any of our outputs
 		for _, vin := range tx.Vin {
-			if vin.Txid != "" {
-				// Get the previous transaction to check if it was to our address
-				var prevTx struct {
-					Vout []struct {
-						ScriptPubKey struct {
-							Addresses []string `json:"addresses"`
-						} `json:"scriptPubKey"`
-					} `json:"vout"`
+			if vin.Txid == "" {
+				continue // coinbase
+			}
+			var addresses []string
+			if prev, ok := created[vin.Txid]; ok {
+				if vin.Vout < len(prev.Vout) {
+					addresses = prev.Vout[vin.Vout].ScriptPubKey.Addresses
+				}
+			} else {
+				var err error
+				addresses, err = prevOut(vin.Txid, vin.Vout)
+				if errors.Is(err, ErrBreakerOpen) {
+					return nil, err
 				}
-				err := c.Request("getrawtransaction", []any{vin.Txid, 1}, &prevTx)
 				if err != nil {
 					continue
 				}
+			}
 
-				// Check if the spent output was to our address
-				if vin.Vout < len(prevTx.Vout) {
-					for _, addr := range prevTx.Vout[vin.Vout].ScriptPubKey.Addresses {
-						if addr == address {
-							// This transaction is spending our output
-							transactions = append(transactions, spec.Transaction{
-								Hash:    vin.Txid,
-								Amount:  0, // We'll get the amount from the original transaction
-								IsSpent: true,
-							})
-						}
-					}
+			// Check if the spent output was to our address
+			for _, addr := range addresses {
+				if addr == address {
+					// This transaction is spending our output
+					transactions = append(transactions, spec.Transaction{
+						Hash:    vin.Txid,
+						Vout:    vin.Vout,
+						Amount:  0, // We'll get the amount from the original transaction
+						IsSpent: true,
+						SpentBy: tx.Txid,
+					})
 				}
 			}
 		}
 
-		// Check outputs for payments to the address
-		for voutIdx, vout := range tx.Vout {
+		// Check outputs for payments to the address. Whether an output is
+		// spent by now doesn't matter: its spend is reported, as an input,
+		// with the block that spends it (later in this block, or a later one).
+		for n, vout := range tx.Vout {
 			for _, addr := range vout.ScriptPubKey.Addresses {
 				if addr == address {
-					// Use gettxout to check if the output is still unspent
-					var txout struct {
-						Confirmations int64 `json:"confirmations"`
-					}
-					err := c.Request("gettxout", []any{tx.Txid, voutIdx}, &txout)
-
-					// If gettxout returns an error, it means the output is spent
-					isSpent := err != nil
-
-					// If we think it's spent, verify by checking the transaction's status
-					if isSpent {
-						var rawTx struct {
-							Confirmations int64 `json:"confirmations"`
-						}
-						err := c.Request("getrawtransaction", []any{tx.Txid, 1}, &rawTx)
-						if err == nil && rawTx.Confirmations > 0 {
-							// Transaction is confirmed and spent
-							transactions = append(transactions, spec.Transaction{
-								Hash:    tx.Txid,
-								Amount:  vout.Value,
-								IsSpent: true,
-							})
-						} else {
-							// Transaction might not be spent yet or is invalid
-							transactions = append(transactions, spec.Transaction{
-								Hash:    tx.Txid,
-								Amount:  vout.Value,
-								IsSpent: false,
-							})
-						}
-					} else {
-						// Transaction is definitely unspent
-						transactions = append(transactions, spec.Transaction{
-							Hash:    tx.Txid,
-							Amount:  vout.Value,
-							IsSpent: false,
-						})
-					}
+					transactions = append(transactions, spec.Transaction{
+						Hash:       tx.Txid,
+						Vout:       n,
+						Amount:     vout.Value,
+						Size:       tx.Size,
+						VSize:      vsize,
+						Script:     vout.ScriptPubKey.Hex,
+						ScriptType: vout.ScriptPubKey.Type,
+					})
 				}
 			}
 		}
+		created[tx.Txid] = tx
 	}
 
 	return transactions, nil
@@ -172,8 +293,6 @@ func (c *CoreRPCClient) GetAddressTransactions(address string, height int64) ([]
 
 func (c *CoreRPCClient) Request(method string, params []any, result any) error {
 	id := c.id.Add(1) // each request should use a unique ID
-	c.lock.Lock()
-	defer c.lock.Unlock()
 	body := rpcRequest{
 		Method: method,
 		Params: params,
@@ -188,8 +307,14 @@ func (c *CoreRPCClient) Request(method string, params []any, result any) error {
 		return fmt.Errorf("json-rpc request: %v", err)
 	}
 	req.SetBasicAuth(c.user, c.pass)
-	res, err := http.DefaultClient.Do(req) // HERE
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+	}
+	res, err := c.client.Do(req) // HERE
 	if err != nil {
+		c.recordFailure(true)
 		return fmt.Errorf("json-rpc transport: %v", err)
 	}
 	// we MUST read all of res.Body and call res.Close,
@@ -197,8 +322,12 @@ func (c *CoreRPCClient) Request(method string, params []any, result any) error {
 	defer res.Body.Close()
 	res_bytes, err := io.ReadAll(res.Body)
 	if err != nil {
+		c.recordFailure(true)
 		return fmt.Errorf("json-rpc read response: %v", err)
 	}
+	// The node answered. Only "work queue depth exceeded" counts against it:
+	// RPC errors (spent outputs, unknown txids) are normal answers.
+	c.recordFailure(res.StatusCode == http.StatusServiceUnavailable)
 	if res.StatusCode != 200 {
 		return fmt.Errorf("json-rpc status code: %s", res.Status)
 	}
@@ -225,6 +354,13 @@ func (c *CoreRPCClient) Request(method string, params []any, result any) error {
 	return nil
 }
 
+// recordFailure reports a call's outcome to the circuit breaker, if any.
+func (c *CoreRPCClient) recordFailure(failed bool) {
+	if c.breaker != nil {
+		c.breaker.record(failed)
+	}
+}
+
 type rpcRequest struct {
 	Method string `json:"method"`
 	Params []any  `json:"params"`
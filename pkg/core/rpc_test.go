@@ -0,0 +1,308 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+// fakeNode answers the RPC calls GetAddressTransactions makes, each after
+// latency, like a node busy reading blocks from disk. It records how many
+// calls were in flight at once and how many of each method it answered.
+type fakeNode struct {
+	latency  time.Duration
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// called returns how many calls of method the node answered
+func (n *fakeNode) called(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := n.inFlight.Add(1)
+	defer n.inFlight.Add(-1)
+	for {
+		seen := n.maxSeen.Load()
+		if current <= seen || n.maxSeen.CompareAndSwap(seen, current) {
+			break
+		}
+	}
+	time.Sleep(n.latency)
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	if n.calls == nil {
+		n.calls = make(map[string]int)
+	}
+	n.calls[req.Method]++
+	n.mu.Unlock()
+	var result any
+	switch req.Method {
+	case "getblockcount":
+		result = 100
+	case "getblockhash":
+		result = fmt.Sprintf("%064v", req.Params[0])
+	case "getblock":
+		result = map[string]any{"tx": []any{
+			map[string]any{
+				"txid": "b1",
+				"vin":  []any{map[string]any{"txid": "a1", "vout": 0}},
+				"vout": []any{map[string]any{"value": 10.0, "scriptPubKey": map[string]any{"addresses": []string{"DAddress0"}}}},
+			},
+		}}
+	case "getrawtransaction":
+		result = map[string]any{"vout": []any{map[string]any{"scriptPubKey": map[string]any{"addresses": []string{"DAddress1"}}}}}
+	default:
+		http.Error(w, "unknown method "+req.Method, http.StatusBadRequest)
+		return
+	}
+	raw, _ := json.Marshal(result)
+	msg := json.RawMessage(raw)
+	json.NewEncoder(w).Encode(rpcResponse{Id: req.Id, Result: &msg})
+}
+
+func newTestClient(t testing.TB, node *fakeNode) *CoreRPCClient {
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+	return NewCoreRPCClient(host, portNumber, "user", "pass", nil)
+}
+
+func TestRequestsRunConcurrently(t *testing.T) {
+	node := &fakeNode{latency: 20 * time.Millisecond}
+	client := newTestClient(t, node)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetBlockCount(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if max := node.maxSeen.Load(); max < 2 {
+		t.Errorf("at most %d call in flight, want concurrent calls", max)
+	}
+}
+
+// BenchmarkGetAddressTransactions fetches one block's transactions for 16
+// addresses split across shards goroutines, as processBlock does with
+// -shards. With 1ms of node latency per call, more shards finish sooner.
+func BenchmarkGetAddressTransactions(b *testing.B) {
+	const addresses = 16
+	for _, shards := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			client := newTestClient(b, &fakeNode{latency: time.Millisecond})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for shard := 0; shard < shards; shard++ {
+					wg.Add(1)
+					go func(shard int) {
+						defer wg.Done()
+						for a := shard; a < addresses; a += shards {
+							if _, err := client.GetAddressTransactions(fmt.Sprintf("DAddress%d", a), 100); err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}(shard)
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
+
+func TestAddressTransactionsInBlockOrder(t *testing.T) {
+	const address = "DTracked"
+	// a1 pays the address, b1 (later in the block) spends that output and
+	// pays change back to it, c1 spends an output from an earlier block
+	var block verboseBlock
+	err := json.Unmarshal([]byte(`{"tx": [
+		{"txid": "coinbase", "vin": [{}], "vout": [{"value": 10000, "scriptPubKey": {"addresses": ["DMiner"]}}]},
+		{"txid": "a1", "size": 226, "vin": [{"txid": "old0", "vout": 0}], "vout": [
+			{"value": 5, "scriptPubKey": {"addresses": ["DOther"]}},
+			{"value": 10, "scriptPubKey": {"hex": "76a9", "type": "pubkeyhash", "addresses": ["DTracked"]}}
+		]},
+		{"txid": "b1", "size": 225, "vin": [{"txid": "a1", "vout": 1}, {"txid": "a1", "vout": 0}], "vout": [
+			{"value": 4, "scriptPubKey": {"addresses": ["DTracked"]}},
+			{"value": 10.9, "scriptPubKey": {"addresses": ["DOther"]}}
+		]},
+		{"txid": "c1", "size": 192, "vin": [{"txid": "old1", "vout": 2}], "vout": [
+			{"value": 1, "scriptPubKey": {"addresses": ["DOther"]}}
+		]}
+	]}`), &block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lookups []string
+	prevOut := func(txid string, vout int) ([]string, error) {
+		lookups = append(lookups, fmt.Sprintf("%s:%d", txid, vout))
+		switch txid {
+		case "old0":
+			return []string{"DOther"}, nil
+		case "old1":
+			return []string{address}, nil
+		}
+		return nil, fmt.Errorf("no such transaction %s", txid)
+	}
+
+	got, err := addressTransactions(block, address, prevOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spec.Transaction{
+		{Hash: "a1", Vout: 1, Amount: 10 * spec.KoinuPerDoge, Size: 226, VSize: 226, Script: "76a9", ScriptType: "pubkeyhash"},
+		{Hash: "a1", Vout: 1, IsSpent: true, SpentBy: "b1"},
+		{Hash: "b1", Vout: 0, Amount: 4 * spec.KoinuPerDoge, Size: 225, VSize: 225},
+		{Hash: "old1", Vout: 2, IsSpent: true, SpentBy: "c1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("addressTransactions() =\n%+v\nwant\n%+v", got, want)
+	}
+	// Outputs created in the block are not looked up on the node
+	if wantLookups := []string{"old0:0", "old1:2"}; !reflect.DeepEqual(lookups, wantLookups) {
+		t.Errorf("looked up %v, want %v", lookups, wantLookups)
+	}
+}
+
+func TestAddressTransactionsLookupErrors(t *testing.T) {
+	var block verboseBlock
+	err := json.Unmarshal([]byte(`{"tx": [
+		{"txid": "a1", "vin": [{"txid": "old0", "vout": 0}], "vout": [
+			{"value": 1, "scriptPubKey": {"addresses": ["DTracked"]}}
+		]}
+	]}`), &block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An input that cannot be looked up is skipped
+	got, err := addressTransactions(block, "DTracked", func(string, int) ([]string, error) {
+		return nil, fmt.Errorf("no such transaction")
+	})
+	if err != nil || len(got) != 1 || got[0].Hash != "a1" {
+		t.Errorf("with a failed lookup: got %+v, %v, want only the a1 output", got, err)
+	}
+
+	// With the circuit breaker open the block must be retried
+	_, err = addressTransactions(block, "DTracked", func(string, int) ([]string, error) {
+		return nil, ErrBreakerOpen
+	})
+	if err != ErrBreakerOpen {
+		t.Errorf("with the breaker open: err = %v, want ErrBreakerOpen", err)
+	}
+}
+
+// Every address's lookup in a block shares one getblock call and one
+// getrawtransaction call per spent transaction, even from concurrent shards;
+// the next block is fetched anew
+func TestGetAddressTransactionsFetchesBlockOnce(t *testing.T) {
+	node := &fakeNode{}
+	client := newTestClient(t, node)
+
+	const addresses, shards = 8, 4
+	var wg sync.WaitGroup
+	for shard := 0; shard < shards; shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			for a := shard; a < addresses; a += shards {
+				txs, err := client.GetAddressTransactions(fmt.Sprintf("DAddress%d", a), 100)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// DAddress0 is paid by b1, DAddress1 spends a1:0 in it
+				if want := a <= 1; (len(txs) == 1) != want {
+					t.Errorf("DAddress%d has %d transactions", a, len(txs))
+				}
+			}
+		}(shard)
+	}
+	wg.Wait()
+	if got := node.called("getblock"); got != 1 {
+		t.Errorf("getblock called %d times for one block, want 1", got)
+	}
+	if got := node.called("getrawtransaction"); got != 1 {
+		t.Errorf("getrawtransaction called %d times for one spent transaction, want 1", got)
+	}
+
+	if _, err := client.GetAddressTransactions("DAddress0", 101); err != nil {
+		t.Fatal(err)
+	}
+	if got := node.called("getblock"); got != 2 {
+		t.Errorf("getblock called %d times for two blocks, want 2", got)
+	}
+}
+
+// Outputs paid to the address carry their positive amount, spends of its
+// outputs carry none: direction is IsSpent, never the sign of Amount
+func TestAddressTransactionsSignMatchesDirection(t *testing.T) {
+	var block verboseBlock
+	err := json.Unmarshal([]byte(`{"tx": [
+		{"txid": "a1", "vin": [{"txid": "old0", "vout": 0}], "vout": [
+			{"value": 0.00000001, "scriptPubKey": {"addresses": ["DTracked"]}},
+			{"value": 99.5, "scriptPubKey": {"addresses": ["DOther"]}}
+		]},
+		{"txid": "b1", "vin": [{"txid": "a1", "vout": 0}, {"txid": "old1", "vout": 3}], "vout": [
+			{"value": 12.34567891, "scriptPubKey": {"addresses": ["DOther", "DTracked"]}}
+		]}
+	]}`), &block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := addressTransactions(block, "DTracked", func(txid string, vout int) ([]string, error) {
+		return []string{"DTracked"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outputs, spends int
+	for _, tx := range got {
+		switch {
+		case tx.Amount < 0:
+			t.Errorf("%s:%d has a negative amount %s", tx.Hash, tx.Vout, tx.Amount)
+		case tx.IsSpent && tx.Amount != 0:
+			t.Errorf("spend of %s:%d carries amount %s", tx.Hash, tx.Vout, tx.Amount)
+		case tx.IsSpent:
+			spends++
+		default:
+			outputs++
+		}
+	}
+	// a1:0 and b1:0 are outputs; old0:0, a1:0 and old1:3 are spends
+	if outputs != 2 || spends != 3 {
+		t.Errorf("got %d outputs and %d spends, want 2 and 3: %+v", outputs, spends, got)
+	}
+}
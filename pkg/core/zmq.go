@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log"
@@ -11,14 +12,34 @@ import (
 	"github.com/pebbe/zmq4"
 )
 
+// ZMQ block topics published by Core (-zmqpubhashblock / -zmqpubrawblock)
+const (
+	TopicHashBlock = "hashblock"
+	TopicRawBlock  = "rawblock"
+)
+
+// ZMQOptions tune the subscription to the node's ZMQ interface.
+type ZMQOptions struct {
+	Topic                string        // block topic: TopicHashBlock or TopicRawBlock
+	HighWaterMark        int           // max queued messages (0: libzmq default)
+	ReconnectInterval    time.Duration // wait before reconnecting (0: libzmq default)
+	ReconnectIntervalMax time.Duration // backoff cap for reconnects (0: no backoff)
+}
+
 /*
  * CoreZMQListener listens to Core Node ZMQ Interface.
  *
  * newTip channel announces whenever Core finds a new Best Block Hash (Tip change)
  */
-func CoreZMQListener(ctx context.Context, host string, port int) (<-chan string, error) {
+func CoreZMQListener(ctx context.Context, host string, port int, opts ZMQOptions) (<-chan string, error) {
 	newTip := make(chan string, 100)
 	nodeAddress := fmt.Sprintf("tcp://%s:%d", host, port)
+	if opts.Topic == "" {
+		opts.Topic = TopicHashBlock
+	}
+	if opts.Topic != TopicHashBlock && opts.Topic != TopicRawBlock {
+		return nil, fmt.Errorf("unsupported ZMQ block topic: %s", opts.Topic)
+	}
 
 	// Connect to Core
 	sock, err := zmq4.NewSocket(zmq4.SUB)
@@ -26,13 +47,28 @@ func CoreZMQListener(ctx context.Context, host string, port int) (<-chan string,
 		return nil, err
 	}
 	sock.SetRcvtimeo(2 * time.Second) // for shutdown
+	if opts.HighWaterMark > 0 {
+		if err := sock.SetRcvhwm(opts.HighWaterMark); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ReconnectInterval > 0 {
+		if err := sock.SetReconnectIvl(opts.ReconnectInterval); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ReconnectIntervalMax > 0 {
+		if err := sock.SetReconnectIvlMax(opts.ReconnectIntervalMax); err != nil {
+			return nil, err
+		}
+	}
 	err = sock.Connect(nodeAddress)
 	if err != nil {
 		return nil, err
 	}
 
 	// Subscribe to both block and transaction events
-	err = sock.SetSubscribe("hashblock")
+	err = sock.SetSubscribe(opts.Topic)
 	if err != nil {
 		return nil, err
 	}
@@ -44,6 +80,8 @@ func CoreZMQListener(ctx context.Context, host string, port int) (<-chan string,
 	if err != nil {
 		return nil, err
 	}
+	log.Printf("ZMQ: subscribed to %s at %s (high-water mark %d, reconnect %v up to %v)",
+		opts.Topic, nodeAddress, opts.HighWaterMark, opts.ReconnectInterval, opts.ReconnectIntervalMax)
 
 	go func() {
 		for {
@@ -77,9 +115,16 @@ func CoreZMQListener(ctx context.Context, host string, port int) (<-chan string,
 			}
 			tag := string(msg[0])
 			switch tag {
-			case "hashblock":
+			case TopicHashBlock:
 				id := hex.EncodeToString(msg[1])
 				newTip <- id
+			case TopicRawBlock:
+				id, err := rawBlockHash(msg[1])
+				if err != nil {
+					log.Printf("ZMQ err: %s", err)
+					continue
+				}
+				newTip <- id
 			case "hashtx":
 				txid := hex.EncodeToString(msg[1])
 				log.Printf("New transaction detected: %s", txid)
@@ -87,7 +132,7 @@ func CoreZMQListener(ctx context.Context, host string, port int) (<-chan string,
 				// as it will be processed when the block containing it is processed
 			case "rawtx":
 				// This is a raw transaction that might be spending our outputs
-				txid := hex.EncodeToString(msg[1])
+				txid := displayHash(msg[1])
 				log.Printf("Raw transaction received: %s", txid)
 				// We'll process this transaction to check if it spends any of our outputs
 				// The transaction processing will happen in the block processing
@@ -98,3 +143,23 @@ func CoreZMQListener(ctx context.Context, host string, port int) (<-chan string,
 	}()
 	return newTip, nil
 }
+
+// rawBlockHash returns the hash of a serialized block: the hash of its
+// 80-byte header.
+func rawBlockHash(block []byte) (string, error) {
+	if len(block) < 80 {
+		return "", fmt.Errorf("rawblock too short: %d bytes", len(block))
+	}
+	return displayHash(block[:80]), nil
+}
+
+// displayHash returns the double SHA-256 of data, byte-reversed as Core
+// displays block hashes and txids (and as they are stored by the tracker).
+func displayHash(data []byte) string {
+	first := sha256.Sum256(data)
+	hash := sha256.Sum256(first[:])
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:])
+}
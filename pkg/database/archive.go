@@ -0,0 +1,161 @@
+package database
+
+import (
+	"fmt"
+)
+
+// initArchiveSchema creates archived_transactions with the same columns as
+// transactions. Must run after every transactions column has been added:
+// ArchiveTransactions copies rows with SELECT *, so any column added to
+// transactions later must be added to archived_transactions in the same order.
+func (db *DB) initArchiveSchema() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS archived_transactions
+		(LIKE transactions INCLUDING DEFAULTS)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating archived_transactions table: %v", err)
+	}
+	// Columns added to transactions after archived_transactions was introduced
+	_, err = db.Exec(`
+		ALTER TABLE archived_transactions
+		ADD COLUMN IF NOT EXISTS is_dust BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS is_change BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT nextval('change_seq'),
+		ADD COLUMN IF NOT EXISTS script TEXT,
+		ADD COLUMN IF NOT EXISTS script_type VARCHAR(32),
+		ADD COLUMN IF NOT EXISTS vout INTEGER
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding archived_transactions columns: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS archived_transactions_tx_hash_idx
+		ON archived_transactions (tx_hash)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating archived_transactions index: %v", err)
+	}
+	return nil
+}
+
+// ArchiveTransactions moves transactions with more than minConfirmations
+// confirmations, whose outputs have all been spent, from the transactions
+// table to archived_transactions. Returns the number of rows moved.
+func (db *DB) ArchiveTransactions(minConfirmations int64) (int64, error) {
+	res, err := db.Exec(`
+		WITH moved AS (
+			DELETE FROM transactions t
+			WHERE t.confirmations > $1
+				AND NOT EXISTS (
+					SELECT 1 FROM unspent_transactions ut
+					WHERE ut.address_id = t.address_id AND ut.tx_hash = t.tx_hash
+						AND ut.block_height = t.block_height
+				)
+			RETURNING t.*
+		)
+		INSERT INTO archived_transactions
+		SELECT * FROM moved
+	`, minConfirmations)
+	if err != nil {
+		return 0, fmt.Errorf("error archiving transactions: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetTransactionsByHash returns every tracked address's record of a
+// transaction, falling back to the archive if it is not in the hot table.
+// Archived confirmations are computed against the last processed block.
+func (db *DB) GetTransactionsByHash(txHash string) ([]TransactionDetail, error) {
+	details, err := db.queryTransactionDetails(`
+		SELECT a.address, t.tx_hash, t.amount, t.block_height, t.confirmations,
+			t.is_spent, t.is_dust, t.size, t.vsize, t.created_at, FALSE
+		FROM transactions t
+		JOIN addresses a ON t.address_id = a.id
+		WHERE t.tx_hash = $1
+		ORDER BY a.address
+	`, txHash)
+	if err != nil || len(details) > 0 {
+		return details, err
+	}
+	return db.queryTransactionDetails(`
+		SELECT a.address, t.tx_hash, t.amount, t.block_height,
+			COALESCE((SELECT height FROM processed_blocks WHERE id = 1) - t.block_height + 1, t.confirmations),
+			t.is_spent, t.is_dust, t.size, t.vsize, t.created_at, TRUE
+		FROM archived_transactions t
+		JOIN addresses a ON t.address_id = a.id
+		WHERE t.tx_hash = $1
+		ORDER BY a.address
+	`, txHash)
+}
+
+// GetTransactionAddresses returns the tracked addresses a transaction touched
+// and the direction for each: incoming for those it paid (from both the hot
+// and archive tables), outgoing for those whose outputs it spent. An address
+// it spent from and paid change to is listed once in each direction.
+func (db *DB) GetTransactionAddresses(txHash string) ([]TransactionAddress, error) {
+	// Amounts are never negative: a recorded transaction is always one the
+	// address received from. Spends are recorded under the funding
+	// transaction, so they are found by spending txid in spent_outputs.
+	rows, err := db.Query(`
+		SELECT DISTINCT a.id, a.address, t.direction
+		FROM (
+			SELECT address_id, 'incoming' AS direction FROM transactions WHERE tx_hash = $1
+			UNION ALL
+			SELECT address_id, 'incoming' FROM archived_transactions WHERE tx_hash = $1
+			UNION ALL
+			SELECT address_id, 'outgoing' FROM spent_outputs WHERE spent_by = $1
+		) t
+		JOIN addresses a ON t.address_id = a.id
+		ORDER BY a.id, t.direction
+	`, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("error getting transaction addresses: %v", err)
+	}
+	defer rows.Close()
+
+	var addresses []TransactionAddress
+	for rows.Next() {
+		var ta TransactionAddress
+		if err := rows.Scan(&ta.AddressID, &ta.Address, &ta.Direction); err != nil {
+			return nil, fmt.Errorf("error scanning transaction address: %v", err)
+		}
+		addresses = append(addresses, ta)
+	}
+	return addresses, rows.Err()
+}
+
+// GetAddressTransaction returns an address's record of a transaction
+// (hot table first, then the archive), or nil if there is none
+func (db *DB) GetAddressTransaction(address, txHash string) (*TransactionDetail, error) {
+	details, err := db.GetTransactionsByHash(txHash)
+	if err != nil {
+		return nil, err
+	}
+	for i := range details {
+		if details[i].Address == address {
+			return &details[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *DB) queryTransactionDetails(query string, args ...interface{}) ([]TransactionDetail, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting transaction: %v", err)
+	}
+	defer rows.Close()
+
+	var details []TransactionDetail
+	for rows.Next() {
+		var d TransactionDetail
+		err := rows.Scan(&d.Address, &d.TxHash, &d.Amount, &d.BlockHeight, &d.Confirmations,
+			&d.IsSpent, &d.IsDust, &d.Size, &d.VSize, &d.CreatedAt, &d.Archived)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning transaction: %v", err)
+		}
+		details = append(details, d)
+	}
+	return details, rows.Err()
+}
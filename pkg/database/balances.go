@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// GetBalances returns the balances of the given tracked addresses, split
+// into confirmed (unspent outputs with at least the address's
+// required_confirmations or confirmation tier, or trusted change) and
+// pending. Untracked addresses are left out.
+func (db *DB) GetBalances(addresses []string) (map[string]AddressBalance, error) {
+	rows, err := db.Query(`
+		SELECT a.address,
+			COALESCE(SUM(ut.amount) FILTER (WHERE ut.confirmations >= required_confirmations_for(a.required_confirmations, a.confirmation_tiers, ut.amount) OR ($2 AND ut.is_change)), 0),
+			COALESCE(SUM(ut.amount) FILTER (WHERE ut.confirmations < required_confirmations_for(a.required_confirmations, a.confirmation_tiers, ut.amount) AND NOT ($2 AND ut.is_change)), 0)
+		FROM addresses a
+		LEFT JOIN unspent_transactions ut ON ut.address_id = a.id
+		WHERE a.address = ANY($1)
+		GROUP BY a.id
+	`, pq.Array(addresses), db.trustChange)
+	if err != nil {
+		return nil, fmt.Errorf("error getting balances: %v", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[string]AddressBalance, len(addresses))
+	for rows.Next() {
+		var b AddressBalance
+		if err := rows.Scan(&b.Address, &b.Confirmed, &b.Pending); err != nil {
+			return nil, fmt.Errorf("error scanning balance: %v", err)
+		}
+		b.Balance = b.Confirmed + b.Pending
+		balances[b.Address] = b
+	}
+	return balances, rows.Err()
+}
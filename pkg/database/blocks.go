@@ -0,0 +1,307 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+	"github.com/lib/pq"
+)
+
+func (db *DB) initBlocksSchema() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS block_hashes (
+			height INTEGER PRIMARY KEY,
+			hash VARCHAR(64) NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating block_hashes table: %v", err)
+	}
+	// Header time and median-time-past (NULL for blocks processed before
+	// they were stored)
+	_, err = db.Exec(`
+		ALTER TABLE block_hashes
+		ADD COLUMN IF NOT EXISTS block_time TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS median_time TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding block_hashes time columns: %v", err)
+	}
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS block_hashes_hash_idx ON block_hashes (hash)`)
+	if err != nil {
+		return fmt.Errorf("error creating block_hashes index: %v", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS transactions_block_height_idx ON transactions (block_height)`)
+	if err != nil {
+		return fmt.Errorf("error creating transactions block_height index: %v", err)
+	}
+	return nil
+}
+
+// GetBlockAddresses returns the tracked addresses a processed block touched,
+// with what each received and spent in it. Returns nil if the block hash is
+// not one this tracker processed.
+func (db *DB) GetBlockAddresses(hash string) (*BlockAddresses, error) {
+	block := BlockAddresses{Hash: hash, Addresses: []BlockAddress{}}
+	err := db.QueryRow(`SELECT height, median_time FROM block_hashes WHERE hash = $1`, hash).Scan(&block.Height, &block.MedianTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting block height: %v", err)
+	}
+
+	rows, err := db.Query(`
+		WITH received AS (
+			SELECT address_id, SUM(amount) AS amount FROM (
+				SELECT address_id, amount FROM transactions
+				WHERE block_height = $1 AND amount > 0
+				UNION ALL
+				SELECT address_id, amount FROM archived_transactions
+				WHERE block_height = $1 AND amount > 0
+			) t
+			GROUP BY address_id
+		),
+		sent AS (
+			SELECT address_id, SUM(amount) AS amount FROM spent_outputs
+			WHERE spent_height = $1
+			GROUP BY address_id
+		)
+		SELECT a.address, COALESCE(r.amount, 0), COALESCE(s.amount, 0)
+		FROM addresses a
+		LEFT JOIN received r ON r.address_id = a.id
+		LEFT JOIN sent s ON s.address_id = a.id
+		WHERE r.address_id IS NOT NULL OR s.address_id IS NOT NULL
+		ORDER BY a.address
+	`, block.Height)
+	if err != nil {
+		return nil, fmt.Errorf("error getting block addresses: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a BlockAddress
+		if err := rows.Scan(&a.Address, &a.Received, &a.Sent); err != nil {
+			return nil, fmt.Errorf("error scanning block address: %v", err)
+		}
+		a.Net = a.Received - a.Sent
+		block.Addresses = append(block.Addresses, a)
+	}
+	return &block, rows.Err()
+}
+
+// GetReceivedHeight returns the block height at which address received
+// txHash (including archived transactions). found is false if the address
+// has no such incoming transaction.
+func (db *DB) GetReceivedHeight(address, txHash string) (height int64, found bool, err error) {
+	err = db.QueryRow(`
+		SELECT t.block_height FROM (
+			SELECT address_id, block_height FROM transactions
+			WHERE tx_hash = $2 AND amount > 0
+			UNION ALL
+			SELECT address_id, block_height FROM archived_transactions
+			WHERE tx_hash = $2 AND amount > 0
+		) t
+		JOIN addresses a ON a.id = t.address_id
+		WHERE a.address = $1
+		LIMIT 1
+	`, address, txHash).Scan(&height)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting transaction height: %v", err)
+	}
+	return height, true, nil
+}
+
+// BlockTransaction is a transaction recorded for an address at a block height
+type BlockTransaction struct {
+	AddressID int64
+	TxHash    string
+	Amount    spec.Amount
+}
+
+// ClearedTransaction is a transaction deleted by ClearBlock, with the
+// state that must survive the block being processed again
+type ClearedTransaction struct {
+	BlockTransaction
+	SpendableNotified bool
+	CreatedAt         time.Time
+	Archived          bool
+}
+
+// ClearBlock deletes what is recorded at one processed block, so it can be
+// processed again: its transactions (including archived ones), the outputs
+// it created that are still unspent and its balance snapshots. Outputs it
+// spent are unspent again. What is recorded for the addresses in keep is
+// left alone. Returns the deleted transactions, to be passed to
+// RestoreClearedTransactions once the block is recorded again.
+func (db *DB) ClearBlock(height int64, keep []string) ([]ClearedTransaction, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting block clear: %v", err)
+	}
+	defer tx.Rollback()
+
+	kept := pq.Array(keep)
+	var cleared []ClearedTransaction
+	for _, table := range []string{"transactions", "archived_transactions"} {
+		rows, err := tx.Query(fmt.Sprintf(`
+			DELETE FROM %s
+			WHERE block_height = $1
+				AND address_id NOT IN (SELECT id FROM addresses WHERE address = ANY($2))
+			RETURNING address_id, tx_hash, amount, spendable_notified, created_at
+		`, table), height, kept)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting %s: %v", table, err)
+		}
+		for rows.Next() {
+			t := ClearedTransaction{Archived: table == "archived_transactions"}
+			if err := rows.Scan(&t.AddressID, &t.TxHash, &t.Amount, &t.SpendableNotified, &t.CreatedAt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning deleted transaction: %v", err)
+			}
+			cleared = append(cleared, t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error deleting %s: %v", table, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM unspent_transactions
+		WHERE block_height = $1
+			AND address_id NOT IN (SELECT id FROM addresses WHERE address = ANY($2))
+	`, height, kept)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting unspent transactions: %v", err)
+	}
+	// Outputs spent in the block are unspent again, unless created in it too
+	_, err = tx.Exec(`
+		WITH restored AS (
+			DELETE FROM spent_outputs
+			WHERE spent_height = $1
+				AND address_id NOT IN (SELECT id FROM addresses WHERE address = ANY($2))
+			RETURNING address_id, tx_hash, vout, amount, block_height
+		)
+		INSERT INTO unspent_transactions (address_id, tx_hash, vout, amount, block_height, confirmations, is_dust, is_change, created_at)
+		SELECT r.address_id, r.tx_hash, r.vout, r.amount, r.block_height, 0,
+			COALESCE((SELECT t.is_dust FROM transactions t
+				WHERE t.address_id = r.address_id AND t.tx_hash = r.tx_hash AND t.block_height = r.block_height), FALSE),
+			COALESCE((SELECT t.is_change FROM transactions t
+				WHERE t.address_id = r.address_id AND t.tx_hash = r.tx_hash AND t.block_height = r.block_height), FALSE),
+			NOW()
+		FROM restored r
+		WHERE r.block_height < $1
+		ON CONFLICT (address_id, tx_hash, block_height) DO NOTHING
+	`, height, kept)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring spent outputs: %v", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM balance_snapshots
+		WHERE height = $1
+			AND address_id NOT IN (SELECT id FROM addresses WHERE address = ANY($2))
+	`, height, kept)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting balance snapshots: %v", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM utxo_count_snapshots
+		WHERE height = $1
+			AND address_id NOT IN (SELECT id FROM addresses WHERE address = ANY($2))
+	`, height, kept)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting utxo count snapshots: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing block clear: %v", err)
+	}
+	return cleared, nil
+}
+
+// RestoreClearedTransactions carries the state of the transactions
+// ClearBlock deleted over to those recorded again at height: a deposit
+// already announced as spendable is not announced again, the recording
+// time is kept and archived transactions go back to the archive.
+func (db *DB) RestoreClearedTransactions(height int64, cleared []ClearedTransaction) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction restore: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range cleared {
+		_, err := tx.Exec(`
+			UPDATE transactions
+			SET spendable_notified = spendable_notified OR $4, created_at = $5
+			WHERE address_id = $1 AND tx_hash = $2 AND block_height = $3
+		`, t.AddressID, t.TxHash, height, t.SpendableNotified, t.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("error restoring transaction %s: %v", t.TxHash, err)
+		}
+		if !t.Archived {
+			continue
+		}
+		_, err = tx.Exec(`
+			WITH moved AS (
+				DELETE FROM transactions
+				WHERE address_id = $1 AND tx_hash = $2 AND block_height = $3
+				RETURNING *
+			)
+			INSERT INTO archived_transactions
+			SELECT * FROM moved
+		`, t.AddressID, t.TxHash, height)
+		if err != nil {
+			return fmt.Errorf("error archiving transaction %s again: %v", t.TxHash, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction restore: %v", err)
+	}
+	return nil
+}
+
+// GetBlockTransactions returns the transactions recorded at a block height
+func (db *DB) GetBlockTransactions(height int64) ([]BlockTransaction, error) {
+	rows, err := db.Query(`
+		SELECT address_id, tx_hash, amount FROM transactions WHERE block_height = $1
+		UNION ALL
+		SELECT address_id, tx_hash, amount FROM archived_transactions WHERE block_height = $1
+	`, height)
+	if err != nil {
+		return nil, fmt.Errorf("error getting block transactions: %v", err)
+	}
+	defer rows.Close()
+
+	var txs []BlockTransaction
+	for rows.Next() {
+		var t BlockTransaction
+		if err := rows.Scan(&t.AddressID, &t.TxHash, &t.Amount); err != nil {
+			return nil, fmt.Errorf("error scanning block transaction: %v", err)
+		}
+		txs = append(txs, t)
+	}
+	return txs, rows.Err()
+}
+
+// RecordRemovedTransactions adds transactions that are gone from a block
+// height to the removed transaction history.
+func (db *DB) RecordRemovedTransactions(height int64, txs []BlockTransaction, reason string) error {
+	for _, t := range txs {
+		_, err := db.Exec(`
+			INSERT INTO transaction_history (address_id, tx_hash, amount, block_height, removal_reason)
+			VALUES ($1, $2, $3, $4, $5)
+		`, t.AddressID, t.TxHash, t.Amount, height, reason)
+		if err != nil {
+			return fmt.Errorf("error recording removed transaction: %v", err)
+		}
+	}
+	return nil
+}
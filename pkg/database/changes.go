@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Kinds of change in an address's change feed
+const (
+	ChangeTransaction = "transaction" // transaction recorded or updated
+	ChangeUnspent     = "unspent"     // output added (or restored by a rewind)
+	ChangeSpent       = "spent"       // output spent
+	ChangeRemoved     = "removed"     // transaction removed by a rewind or rescan
+)
+
+// changeTables get a change_seq column, drawn from one sequence, that is
+// set when a row is inserted (and bumped when a transaction is updated), so
+// the changes to an address can be listed in order from any point.
+var changeTables = []string{"transactions", "unspent_transactions", "spent_outputs", "transaction_history"}
+
+func (db *DB) initChangesSchema() error {
+	if _, err := db.Exec(`CREATE SEQUENCE IF NOT EXISTS change_seq`); err != nil {
+		return fmt.Errorf("error creating change_seq sequence: %v", err)
+	}
+	for _, table := range changeTables {
+		_, err := db.Exec(fmt.Sprintf(`
+			ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT nextval('change_seq')
+		`, table))
+		if err != nil {
+			return fmt.Errorf("error adding change_seq column to %s: %v", table, err)
+		}
+		_, err = db.Exec(fmt.Sprintf(`
+			CREATE INDEX IF NOT EXISTS %[1]s_address_change_seq_idx
+			ON %[1]s (address_id, change_seq)
+		`, table))
+		if err != nil {
+			return fmt.Errorf("error creating %s change_seq index: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// GetAddressChanges returns the changes to an address after cursor since,
+// oldest first, up to limit of them, and the cursor to continue from (since
+// itself if there are none). found is false if the address is not tracked.
+func (db *DB) GetAddressChanges(address string, since int64, limit int) (changes []AddressChange, cursor int64, found bool, err error) {
+	var addressID int64
+	err = db.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
+	if err == sql.ErrNoRows {
+		return nil, since, false, nil
+	}
+	if err != nil {
+		return nil, since, false, fmt.Errorf("error getting address ID: %v", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT seq, kind, tx_hash, amount, block_height, spent_height, reason FROM (
+			SELECT change_seq AS seq, 'transaction' AS kind, tx_hash, amount, block_height,
+				NULL::INTEGER AS spent_height, NULL::VARCHAR AS reason
+			FROM transactions WHERE address_id = $1 AND change_seq > $2
+			UNION ALL
+			SELECT change_seq, 'transaction', tx_hash, amount, block_height, NULL, NULL
+			FROM archived_transactions WHERE address_id = $1 AND change_seq > $2
+			UNION ALL
+			SELECT change_seq, 'unspent', tx_hash, amount, block_height, NULL, NULL
+			FROM unspent_transactions WHERE address_id = $1 AND change_seq > $2
+			UNION ALL
+			SELECT change_seq, 'spent', tx_hash, amount, block_height, spent_height, NULL
+			FROM spent_outputs WHERE address_id = $1 AND change_seq > $2
+			UNION ALL
+			SELECT change_seq, 'removed', tx_hash, amount, block_height, NULL, removal_reason
+			FROM transaction_history WHERE address_id = $1 AND change_seq > $2
+		) c
+		ORDER BY seq
+		LIMIT $3
+	`, addressID, since, limit)
+	if err != nil {
+		return nil, since, true, fmt.Errorf("error getting address changes: %v", err)
+	}
+	defer rows.Close()
+
+	cursor = since
+	for rows.Next() {
+		var c AddressChange
+		var spentHeight sql.NullInt64
+		var reason sql.NullString
+		if err := rows.Scan(&c.Seq, &c.Kind, &c.TxHash, &c.Amount, &c.BlockHeight, &spentHeight, &reason); err != nil {
+			return nil, since, true, fmt.Errorf("error scanning address change: %v", err)
+		}
+		if spentHeight.Valid {
+			c.SpentHeight = &spentHeight.Int64
+		}
+		c.RemovalReason = reason.String
+		changes = append(changes, c)
+		cursor = c.Seq
+	}
+	return changes, cursor, true, rows.Err()
+}
@@ -2,16 +2,29 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
 )
 
 type DB struct {
 	*sql.DB
+	dustThreshold spec.Amount // outputs below this are flagged is_dust (0 disables)
+	webhookOutbox bool        // queue spendable events in webhook_outbox
+	utxoAlert     int         // queue utxo_threshold events at this unspent output count (0 disables)
+	trustChange   bool        // change outputs are spendable without required_confirmations
 }
 
+// ErrAddressLimit is returned by TrackAddresses when tracking the addresses
+// would take the total over the configured maximum
+var ErrAddressLimit = errors.New("tracked address limit reached")
+
 func NewDB(host string, port int, user, password, dbname string) (*DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
@@ -22,10 +35,24 @@ func NewDB(host string, port int, user, password, dbname string) (*DB, error) {
 	}
 
 	if err = db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("error connecting to database: %v", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
+}
+
+// SetTrustedChange makes change outputs (paid back to an address by a
+// transaction spending from it) count as spendable and confirmed as soon as
+// they are recorded, instead of after the address's required_confirmations.
+func (db *DB) SetTrustedChange(enabled bool) {
+	db.trustChange = enabled
+}
+
+// SetDustThreshold sets the amount below which incoming outputs are flagged
+// as dust when recorded. Zero disables the flag.
+func (db *DB) SetDustThreshold(threshold spec.Amount) {
+	db.dustThreshold = threshold
 }
 
 func (db *DB) InitSchema() error {
@@ -57,13 +84,25 @@ func (db *DB) InitSchema() error {
 			is_confirmed BOOLEAN NOT NULL DEFAULT FALSE,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			UNIQUE(address_id, tx_hash)
+			UNIQUE(address_id, tx_hash, block_height)
 		)
 	`)
 	if err != nil {
 		return fmt.Errorf("error creating transactions table: %v", err)
 	}
 
+	// Lookups by txid (transaction endpoints)
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS transactions_tx_hash_idx ON transactions (tx_hash)`)
+	if err != nil {
+		return fmt.Errorf("error creating transactions tx_hash index: %v", err)
+	}
+
+	// Keyset pagination of an address's transactions, newest first
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS transactions_address_height_id_idx ON transactions (address_id, block_height DESC, id DESC)`)
+	if err != nil {
+		return fmt.Errorf("error creating transactions pagination index: %v", err)
+	}
+
 	// Create unspent_transactions table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS unspent_transactions (
@@ -76,13 +115,43 @@ func (db *DB) InitSchema() error {
 			is_confirmed BOOLEAN NOT NULL DEFAULT FALSE,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			UNIQUE(address_id, tx_hash)
+			UNIQUE(address_id, tx_hash, block_height)
 		)
 	`)
 	if err != nil {
 		return fmt.Errorf("error creating unspent_transactions table: %v", err)
 	}
 
+	// The same txid can occur at two heights (pre-BIP30 duplicate coinbases),
+	// so outputs are unique per block height. Replaces the original
+	// (address_id, tx_hash) constraint on existing databases.
+	for _, table := range []string{"transactions", "unspent_transactions"} {
+		if err := db.migrateTxUniqueness(table); err != nil {
+			return err
+		}
+	}
+
+	// Create spent_outputs table (spent unspent_transactions rows, kept so a
+	// rewind can restore outputs whose spending block is rolled back)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS spent_outputs (
+			id SERIAL PRIMARY KEY,
+			address_id INTEGER NOT NULL REFERENCES addresses(id),
+			tx_hash VARCHAR(64) NOT NULL,
+			amount DECIMAL(20,8) NOT NULL,
+			block_height INTEGER NOT NULL,
+			spent_height INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating spent_outputs table: %v", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS spent_outputs_spent_height_idx ON spent_outputs (spent_height)`)
+	if err != nil {
+		return fmt.Errorf("error creating spent_outputs index: %v", err)
+	}
+
 	// Create processed_blocks table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS processed_blocks (
@@ -96,6 +165,138 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("error creating processed_blocks table: %v", err)
 	}
 
+	// Create transaction_notes table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS transaction_notes (
+			id SERIAL PRIMARY KEY,
+			address_id INTEGER NOT NULL REFERENCES addresses(id),
+			tx_hash VARCHAR(64) NOT NULL,
+			note TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating transaction_notes table: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS transaction_notes_address_tx_idx
+		ON transaction_notes (address_id, tx_hash)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating transaction_notes index: %v", err)
+	}
+
+	// Flag set once a deposit has reached its address's required_confirmations
+	_, err = db.Exec(`
+		ALTER TABLE transactions
+		ADD COLUMN IF NOT EXISTS spendable_notified BOOLEAN NOT NULL DEFAULT FALSE
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding spendable_notified column: %v", err)
+	}
+
+	// Serialized and virtual size of the transaction (NULL when unknown)
+	_, err = db.Exec(`
+		ALTER TABLE transactions
+		ADD COLUMN IF NOT EXISTS size INTEGER,
+		ADD COLUMN IF NOT EXISTS vsize INTEGER
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding size columns: %v", err)
+	}
+
+	// Flag for incoming outputs below the dust threshold
+	for _, table := range []string{"transactions", "unspent_transactions"} {
+		_, err = db.Exec(fmt.Sprintf(`
+			ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS is_dust BOOLEAN NOT NULL DEFAULT FALSE
+		`, table))
+		if err != nil {
+			return fmt.Errorf("error adding is_dust column to %s: %v", table, err)
+		}
+	}
+
+	// Flag for change outputs (paid to an address by a transaction spending from it)
+	for _, table := range []string{"transactions", "unspent_transactions"} {
+		_, err = db.Exec(fmt.Sprintf(`
+			ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS is_change BOOLEAN NOT NULL DEFAULT FALSE
+		`, table))
+		if err != nil {
+			return fmt.Errorf("error adding is_change column to %s: %v", table, err)
+		}
+	}
+
+	// Output script and its type (as the node classifies it), for received outputs
+	_, err = db.Exec(`
+		ALTER TABLE transactions
+		ADD COLUMN IF NOT EXISTS script TEXT,
+		ADD COLUMN IF NOT EXISTS script_type VARCHAR(32)
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding script columns to transactions: %v", err)
+	}
+
+	// Index of the output in its transaction (NULL for rows recorded before it was stored)
+	_, err = db.Exec(`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS vout INTEGER`)
+	if err != nil {
+		return fmt.Errorf("error adding vout column to transactions: %v", err)
+	}
+	// Unspent and spent outputs keep it too, so a spend removes the output
+	// it names and not every output of the txid
+	for _, table := range []string{"unspent_transactions", "spent_outputs"} {
+		_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS vout INTEGER`, table))
+		if err != nil {
+			return fmt.Errorf("error adding vout column to %s: %v", table, err)
+		}
+	}
+
+	// The transaction that spent an output (NULL for spends recorded before
+	// it was stored), for the addresses a transaction spent from
+	_, err = db.Exec(`ALTER TABLE spent_outputs ADD COLUMN IF NOT EXISTS spent_by VARCHAR(64)`)
+	if err != nil {
+		return fmt.Errorf("error adding spent_by column to spent_outputs: %v", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS spent_outputs_spent_by_idx ON spent_outputs (spent_by)`)
+	if err != nil {
+		return fmt.Errorf("error creating spent_outputs spent_by index: %v", err)
+	}
+
+	// Add confirmation_tiers column and required_confirmations_for function
+	if err := db.initTiersSchema(); err != nil {
+		return err
+	}
+
+	// Create transaction_history table (transactions removed by a rewind)
+	if err := db.initDroppedSchema(); err != nil {
+		return err
+	}
+
+	// Create balance_snapshots table
+	if err := db.initHistorySchema(); err != nil {
+		return err
+	}
+
+	// Create webhook_outbox table (events awaiting webhook delivery)
+	if err := db.initOutboxSchema(); err != nil {
+		return err
+	}
+
+	// Create block_hashes table (processed blocks by hash)
+	if err := db.initBlocksSchema(); err != nil {
+		return err
+	}
+
+	// Add change_seq columns for address change feeds
+	if err := db.initChangesSchema(); err != nil {
+		return err
+	}
+
+	// Create archived_transactions table (after all transactions columns exist)
+	if err := db.initArchiveSchema(); err != nil {
+		return err
+	}
+
 	// No need for the trigger anymore since we're using a single row with id=1
 	log.Println("Database schema initialized successfully")
 	return nil
@@ -119,9 +320,16 @@ func (db *DB) GetLastProcessedBlock() (*ProcessedBlock, error) {
 	return &block, nil
 }
 
-// SaveProcessedBlock saves/updates the processed block
-func (db *DB) SaveProcessedBlock(height int64, hash string) error {
-	_, err := db.Exec(`
+// SaveProcessedBlock saves/updates the processed block, and records its
+// hash for lookups by hash
+func (db *DB) SaveProcessedBlock(height int64, hash string, blockTime, medianTime time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error saving processed block: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		INSERT INTO processed_blocks (id, height, hash)
 		VALUES (1, $1, $2)
 		ON CONFLICT (id) DO UPDATE
@@ -132,6 +340,155 @@ func (db *DB) SaveProcessedBlock(height int64, hash string) error {
 	if err != nil {
 		return fmt.Errorf("error saving processed block: %v", err)
 	}
+	_, err = tx.Exec(`
+		INSERT INTO block_hashes (height, hash, block_time, median_time)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (height) DO UPDATE SET hash = $2, block_time = $3, median_time = $4
+	`, height, hash, blockTime, medianTime)
+	if err != nil {
+		return fmt.Errorf("error saving block hash: %v", err)
+	}
+	return tx.Commit()
+}
+
+// RewindProcessedBlocks deletes everything recorded above height and moves
+// the processed block cursor back to it, so those blocks are processed again.
+// Outputs spent above height are restored to unspent_transactions.
+func (db *DB) RewindProcessedBlocks(height int64, hash string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting rewind: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := rollbackAbove(tx, height, 0, RemovedByRewind); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM block_hashes WHERE height > $1`, height)
+	if err != nil {
+		return fmt.Errorf("error deleting block hashes: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO processed_blocks (id, height, hash)
+		VALUES (1, $1, $2)
+		ON CONFLICT (id) DO UPDATE
+		SET height = $1,
+			hash = $2,
+			processed_at = CURRENT_TIMESTAMP
+	`, height, hash)
+	if err != nil {
+		return fmt.Errorf("error saving processed block: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing rewind: %v", err)
+	}
+	return nil
+}
+
+// RewindAddress deletes everything recorded for one address above height,
+// restoring the outputs it spent above height, so the address can be
+// rescanned from height+1. The processed block cursor is not moved.
+func (db *DB) RewindAddress(address string, height int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting address rewind: %v", err)
+	}
+	defer tx.Rollback()
+
+	var addressID int64
+	err = tx.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
+	if err != nil {
+		return fmt.Errorf("error getting address ID: %v", err)
+	}
+	if err := rollbackAbove(tx, height, addressID, RemovedByRescan); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing address rewind: %v", err)
+	}
+	return nil
+}
+
+// rollbackAbove removes the transactions, unspent outputs and balance
+// snapshots above height, restores outputs spent above height, and
+// recomputes balances. An addressID of 0 applies it to every address.
+func rollbackAbove(tx *sql.Tx, height int64, addressID int64, reason string) error {
+	if err := removeTransactionsAbove(tx, height, addressID, reason); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		DELETE FROM unspent_transactions
+		WHERE block_height > $1 AND ($2 = 0 OR address_id = $2)
+	`, height, addressID)
+	if err != nil {
+		return fmt.Errorf("error deleting unspent transactions: %v", err)
+	}
+	// Outputs created at or below the new tip but spent above it are unspent again
+	_, err = tx.Exec(`
+		WITH restored AS (
+			DELETE FROM spent_outputs
+			WHERE spent_height > $1 AND ($2 = 0 OR address_id = $2)
+			RETURNING address_id, tx_hash, vout, amount, block_height
+		)
+		INSERT INTO unspent_transactions (address_id, tx_hash, vout, amount, block_height, confirmations, is_dust, is_change, created_at)
+		SELECT r.address_id, r.tx_hash, r.vout, r.amount, r.block_height, 0,
+			COALESCE((SELECT t.is_dust FROM transactions t
+				WHERE t.address_id = r.address_id AND t.tx_hash = r.tx_hash AND t.block_height = r.block_height), FALSE),
+			COALESCE((SELECT t.is_change FROM transactions t
+				WHERE t.address_id = r.address_id AND t.tx_hash = r.tx_hash AND t.block_height = r.block_height), FALSE),
+			NOW()
+		FROM restored r
+		WHERE r.block_height <= $1
+		ON CONFLICT (address_id, tx_hash, block_height) DO NOTHING
+	`, height, addressID)
+	if err != nil {
+		return fmt.Errorf("error restoring spent outputs: %v", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM balance_snapshots
+		WHERE height > $1 AND ($2 = 0 OR address_id = $2)
+	`, height, addressID)
+	if err != nil {
+		return fmt.Errorf("error deleting balance snapshots: %v", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM utxo_count_snapshots
+		WHERE height > $1 AND ($2 = 0 OR address_id = $2)
+	`, height, addressID)
+	if err != nil {
+		return fmt.Errorf("error deleting utxo count snapshots: %v", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE addresses a
+		SET balance = (
+			SELECT COALESCE(SUM(ut.amount), 0)
+			FROM unspent_transactions ut
+			WHERE ut.address_id = a.id
+		), updated_at = NOW()
+		WHERE $1 = 0 OR a.id = $1
+	`, addressID)
+	if err != nil {
+		return fmt.Errorf("error recomputing balances: %v", err)
+	}
+	return nil
+}
+
+// migrateTxUniqueness replaces a table's original UNIQUE(address_id, tx_hash)
+// constraint with UNIQUE(address_id, tx_hash, block_height)
+func (db *DB) migrateTxUniqueness(table string) error {
+	_, err := db.Exec(fmt.Sprintf(`
+		CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_address_id_tx_hash_block_height_key
+		ON %[1]s (address_id, tx_hash, block_height)
+	`, table))
+	if err != nil {
+		return fmt.Errorf("error creating %s uniqueness index: %v", table, err)
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %[1]s DROP CONSTRAINT IF EXISTS %[1]s_address_id_tx_hash_key`, table))
+	if err != nil {
+		return fmt.Errorf("error dropping %s uniqueness constraint: %v", table, err)
+	}
 	return nil
 }
 
@@ -154,8 +511,110 @@ func (db *DB) GetTrackedAddresses() ([]string, error) {
 	return addresses, nil
 }
 
-// InsertTransaction inserts a new transaction into the database
-func (db *DB) InsertTransaction(txHash, address string, amount float64, height int64) error {
+// GetAddressesWithInvalidConfirmations returns tracked addresses whose
+// required_confirmations is below 1 (only possible via direct DB edits)
+func (db *DB) GetAddressesWithInvalidConfirmations() ([]AddressConfig, error) {
+	return db.queryAddressConfigs("SELECT address, required_confirmations, confirmation_tiers FROM addresses WHERE required_confirmations < 1 ORDER BY id")
+}
+
+// GetAddressConfigs returns every tracked address with its settings
+func (db *DB) GetAddressConfigs() ([]AddressConfig, error) {
+	return db.queryAddressConfigs("SELECT address, required_confirmations, confirmation_tiers FROM addresses ORDER BY id")
+}
+
+func (db *DB) queryAddressConfigs(query string, args ...interface{}) ([]AddressConfig, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tracked addresses: %v", err)
+	}
+	defer rows.Close()
+
+	var configs []AddressConfig
+	for rows.Next() {
+		var c AddressConfig
+		var tiers []byte
+		if err := rows.Scan(&c.Address, &c.RequiredConfirmations, &tiers); err != nil {
+			return nil, fmt.Errorf("error scanning tracked address: %v", err)
+		}
+		if tiers != nil {
+			if err := json.Unmarshal(tiers, &c.ConfirmationTiers); err != nil {
+				return nil, fmt.Errorf("error decoding confirmation tiers of %s: %v", c.Address, err)
+			}
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+// TrackAddresses adds addresses for tracking, or updates the settings of
+// already-tracked ones, all in one database transaction. If maxAddresses is
+// positive and the new addresses would take the total above it, nothing is
+// tracked and ErrAddressLimit is returned.
+func (db *DB) TrackAddresses(configs []AddressConfig, maxAddresses int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if maxAddresses > 0 {
+		// Serialize concurrent registrations so the count below stays accurate
+		if _, err := tx.Exec("LOCK TABLE addresses IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return fmt.Errorf("error locking addresses: %v", err)
+		}
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO addresses (address, required_confirmations, confirmation_tiers)
+		VALUES ($1, $2, $3::JSONB)
+		ON CONFLICT (address) DO UPDATE
+		SET required_confirmations = $2, confirmation_tiers = $3::JSONB, updated_at = NOW()
+	`)
+	if err != nil {
+		return fmt.Errorf("error preparing insert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range configs {
+		tiers, err := tiersParam(c.ConfirmationTiers)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(c.Address, c.RequiredConfirmations, tiers); err != nil {
+			return fmt.Errorf("error tracking address %s: %v", c.Address, err)
+		}
+	}
+
+	if maxAddresses > 0 {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM addresses").Scan(&count); err != nil {
+			return fmt.Errorf("error counting addresses: %v", err)
+		}
+		if count > maxAddresses {
+			return ErrAddressLimit
+		}
+	}
+	return tx.Commit()
+}
+
+// CountTrackedAddresses returns the number of tracked addresses
+func (db *DB) CountTrackedAddresses() (int, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM addresses").Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting addresses: %v", err)
+	}
+	return count, nil
+}
+
+// InsertTransaction inserts a new transaction into the database.
+// vout is the index of the address's output in the transaction.
+// size and vsize are stored as NULL when 0 (unknown)
+func (db *DB) InsertTransaction(txHash string, vout int, address string, amount spec.Amount, height int64, confirmations int, size, vsize int, script, scriptType string) error {
+	// Amounts are what the address received, never signed by direction
+	if amount < 0 {
+		return fmt.Errorf("negative amount %v for transaction %s", amount, txHash)
+	}
+
 	// First get the address_id
 	var addressID int64
 	err := db.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
@@ -163,26 +622,54 @@ func (db *DB) InsertTransaction(txHash, address string, amount float64, height i
 		return fmt.Errorf("error getting address ID: %v", err)
 	}
 
-	// Insert the transaction
+	// Insert the transaction. A zero amount is a spend of an earlier output
+	// of txHash; it is only recorded if that output is not already stored.
 	_, err = db.Exec(`
-		INSERT INTO transactions (tx_hash, address_id, amount, block_height, confirmations, created_at)
-		VALUES ($1, $2, $3, $4, 1, NOW())
-		ON CONFLICT (address_id, tx_hash) DO NOTHING
-	`, txHash, addressID, amount, height)
+		INSERT INTO transactions (tx_hash, address_id, amount, block_height, confirmations, size, vsize, is_dust, script, script_type, vout, created_at)
+		SELECT $1::VARCHAR, $2::INTEGER, $3::DECIMAL, $4::INTEGER, $8::INTEGER, NULLIF($5::INTEGER, 0), NULLIF($6::INTEGER, 0),
+			$3::DECIMAL > 0 AND $3::DECIMAL < $7::DECIMAL, NULLIF($9::TEXT, ''), NULLIF($10::VARCHAR, ''), $11::INTEGER, NOW()
+		WHERE $3::DECIMAL <> 0
+			OR NOT EXISTS (SELECT 1 FROM transactions WHERE address_id = $2 AND tx_hash = $1)
+		ON CONFLICT (address_id, tx_hash, block_height) DO NOTHING
+	`, txHash, addressID, amount, height, size, vsize, db.dustThreshold, confirmations, script, scriptType, vout)
 	return err
 }
 
-// MarkTransactionSpent marks a transaction as spent in the database
-func (db *DB) MarkTransactionSpent(txHash string) error {
+// MarkTransactionSpent marks an address's output txHash:vout as spent by
+// transaction spentBy in the database
+func (db *DB) MarkTransactionSpent(txHash string, vout int, address string, spentHeight int64, spentBy string) error {
+	// Keep the spent output so RewindProcessedBlocks can restore it. Only
+	// one output is spent: when the txid recurs at two heights (pre-BIP30
+	// duplicate coinbases) the later output replaced the earlier one in
+	// the node's UTXO set, so that is the one the spend takes.
 	_, err := db.Exec(`
-		DELETE FROM unspent_transactions
-		WHERE tx_hash = $1
-	`, txHash)
+		WITH spent AS (
+			DELETE FROM unspent_transactions
+			WHERE id = (
+				SELECT ut.id FROM unspent_transactions ut
+				WHERE ut.tx_hash = $1
+					AND (ut.vout = $2 OR ut.vout IS NULL)
+					AND ut.address_id = (SELECT id FROM addresses WHERE address = $3)
+					AND ut.block_height <= $4
+				ORDER BY ut.block_height DESC
+				LIMIT 1
+			)
+			RETURNING address_id, tx_hash, vout, amount, block_height
+		)
+		INSERT INTO spent_outputs (address_id, tx_hash, vout, amount, block_height, spent_height, spent_by)
+		SELECT address_id, tx_hash, vout, amount, block_height, $4::INTEGER, NULLIF($5::VARCHAR, '')
+		FROM spent
+	`, txHash, vout, address, spentHeight, spentBy)
 	return err
 }
 
 // InsertUnspentTransaction inserts a new unspent transaction
-func (db *DB) InsertUnspentTransaction(txHash, address string, amount float64, height int64) error {
+func (db *DB) InsertUnspentTransaction(txHash string, vout int, address string, amount spec.Amount, height int64, confirmations int) error {
+	// Amounts are what the address received, never signed by direction
+	if amount < 0 {
+		return fmt.Errorf("negative amount %v for transaction %s", amount, txHash)
+	}
+
 	// First get the address_id
 	var addressID int64
 	err := db.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
@@ -190,18 +677,84 @@ func (db *DB) InsertUnspentTransaction(txHash, address string, amount float64, h
 		return fmt.Errorf("error getting address ID: %v", err)
 	}
 
-	// Insert the unspent transaction
+	// Insert the unspent transaction, unless its spend is already recorded
+	// (its block is being processed again)
 	_, err = db.Exec(`
-		INSERT INTO unspent_transactions (tx_hash, address_id, amount, block_height, confirmations, created_at)
-		VALUES ($1, $2, $3, $4, 1, NOW())
-		ON CONFLICT (address_id, tx_hash) DO NOTHING
-	`, txHash, addressID, amount, height)
+		INSERT INTO unspent_transactions (tx_hash, address_id, amount, block_height, confirmations, is_dust, vout, created_at)
+		SELECT $1::VARCHAR, $2::INTEGER, $3::DECIMAL, $4::INTEGER, $6::INTEGER, $3::DECIMAL > 0 AND $3::DECIMAL < $5::DECIMAL, $7::INTEGER, NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM spent_outputs
+			WHERE address_id = $2 AND tx_hash = $1 AND block_height = $4
+		)
+		ON CONFLICT (address_id, tx_hash, block_height) DO NOTHING
+	`, txHash, addressID, amount, height, db.dustThreshold, confirmations, vout)
 	return err
 }
 
+// RefreshAllBalances recomputes every address's stored balance from its
+// unspent outputs.
+func (db *DB) RefreshAllBalances() error {
+	_, err := db.Exec(`
+		UPDATE addresses a
+		SET balance = (
+			SELECT COALESCE(SUM(ut.amount), 0)
+			FROM unspent_transactions ut
+			WHERE ut.address_id = a.id
+		), updated_at = NOW()
+	`)
+	if err != nil {
+		return fmt.Errorf("error recomputing balances: %v", err)
+	}
+	return nil
+}
+
+// MarkChange flags an address's output of txHash at height as change: the
+// transaction that created it also spent from the address.
+func (db *DB) MarkChange(txHash, address string, height int64) error {
+	for _, table := range []string{"transactions", "unspent_transactions"} {
+		_, err := db.Exec(fmt.Sprintf(`
+			UPDATE %s
+			SET is_change = TRUE, change_seq = nextval('change_seq')
+			WHERE tx_hash = $1 AND block_height = $3 AND NOT is_change
+				AND address_id = (SELECT id FROM addresses WHERE address = $2)
+		`, table), txHash, address, height)
+		if err != nil {
+			return fmt.Errorf("error marking change in %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// GetUnspentOutputs returns the unspent transactions of a tracked address
+func (db *DB) GetUnspentOutputs(address string) ([]UnspentTransaction, error) {
+	rows, err := db.Query(`
+		SELECT ut.id, ut.tx_hash, COALESCE(t.vout, -1), ut.address_id, ut.amount, ut.block_height, ut.confirmations, ut.is_dust, ut.created_at, ut.updated_at
+		FROM unspent_transactions ut
+		JOIN addresses a ON ut.address_id = a.id
+		LEFT JOIN transactions t ON t.address_id = ut.address_id AND t.tx_hash = ut.tx_hash AND t.block_height = ut.block_height
+		WHERE a.address = $1
+		ORDER BY ut.block_height, ut.id
+	`, address)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unspent outputs: %v", err)
+	}
+	defer rows.Close()
+
+	var utxos []UnspentTransaction
+	for rows.Next() {
+		var u UnspentTransaction
+		err := rows.Scan(&u.ID, &u.TxHash, &u.Vout, &u.AddressID, &u.Amount, &u.BlockHeight, &u.Confirmations, &u.IsDust, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning unspent output: %v", err)
+		}
+		utxos = append(utxos, u)
+	}
+	return utxos, rows.Err()
+}
+
 // GetAddressBalance returns the current balance for an address
-func (db *DB) GetAddressBalance(address string) (float64, error) {
-	var balance float64
+func (db *DB) GetAddressBalance(address string) (spec.Amount, error) {
+	var balance spec.Amount
 	err := db.QueryRow(`
 		SELECT COALESCE(SUM(ut.amount), 0)
 		FROM unspent_transactions ut
@@ -211,12 +764,175 @@ func (db *DB) GetAddressBalance(address string) (float64, error) {
 	return balance, err
 }
 
-// UpdateAddressBalance updates the balance for an address
-func (db *DB) UpdateAddressBalance(address string, balance float64) error {
-	_, err := db.Exec(`
-		UPDATE addresses
-		SET balance = $1, updated_at = NOW()
-		WHERE address = $2
-	`, balance, address)
-	return err
+// RefreshAddressBalance recomputes an address's stored balance from its
+// unspent outputs and returns it. The address row is locked before the sum
+// is taken, so a concurrent refresh that summed earlier cannot store its
+// stale balance over this one.
+func (db *DB) RefreshAddressBalance(address string) (spec.Amount, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting balance refresh: %v", err)
+	}
+	defer tx.Rollback()
+
+	var addressID int64
+	err = tx.QueryRow("SELECT id FROM addresses WHERE address = $1 FOR UPDATE", address).Scan(&addressID)
+	if err != nil {
+		return 0, fmt.Errorf("error locking address: %v", err)
+	}
+	// A new statement, so the sum sees everything committed before the lock
+	var balance spec.Amount
+	err = tx.QueryRow(`
+		UPDATE addresses a
+		SET balance = (
+			SELECT COALESCE(SUM(ut.amount), 0)
+			FROM unspent_transactions ut
+			WHERE ut.address_id = a.id
+		), updated_at = NOW()
+		WHERE a.id = $1
+		RETURNING a.balance
+	`, addressID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("error updating balance: %v", err)
+	}
+	return balance, tx.Commit()
+}
+
+// confirmationsSQL computes confirmations of a row relative to the tip height in $1.
+// Rows without a height, or above the tip (e.g. the tip went backwards in a reorg),
+// have 0 confirmations rather than a negative count.
+const confirmationsSQL = `CASE
+			WHEN block_height IS NULL OR block_height > $1::BIGINT THEN 0
+			ELSE $1::BIGINT - block_height + 1
+		END`
+
+// UpdateConfirmations recomputes confirmations for all transactions and unspent
+// transactions relative to the given chain tip height
+func (db *DB) UpdateConfirmations(tipHeight int64) error {
+	for _, table := range []string{"transactions", "unspent_transactions"} {
+		_, err := db.Exec(`
+		UPDATE `+table+`
+		SET confirmations = `+confirmationsSQL+`,
+			updated_at = NOW()
+		WHERE confirmations IS DISTINCT FROM `+confirmationsSQL, tipHeight)
+		if err != nil {
+			return fmt.Errorf("error updating %s confirmations: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// MarkSpendableTransactions flags incoming transactions that have reached their
+// address's required_confirmations (or the confirmation tier for their
+// amount) and returns the ones flagged by this call, so each deposit is
+// reported exactly once. required_confirmations below 1 (only possible via
+// direct DB edits) is treated as 1. With queueWebhook
+// false they are flagged without queueing webhook events.
+func (db *DB) MarkSpendableTransactions(queueWebhook bool) ([]SpendableTransaction, error) {
+	rows, err := db.Query(`
+		WITH marked AS (
+			UPDATE transactions t
+			SET spendable_notified = TRUE, updated_at = NOW()
+			FROM addresses a
+			WHERE t.address_id = a.id
+				AND NOT t.spendable_notified
+				AND t.amount > 0
+				AND (t.confirmations >= required_confirmations_for(a.required_confirmations, a.confirmation_tiers, t.amount)
+					OR ($2 AND t.is_change))
+			RETURNING t.id, a.address, t.tx_hash, t.amount, t.block_height, t.confirmations
+		),
+		queued AS (
+			INSERT INTO webhook_outbox (event_type, address, tx_hash, amount, block_height, confirmations)
+			SELECT 'spendable', address, tx_hash, amount, block_height, confirmations
+			FROM marked
+			WHERE $1
+			ORDER BY id
+		)
+		SELECT address, tx_hash, amount, block_height, confirmations
+		FROM marked
+		ORDER BY id
+	`, db.webhookOutbox && queueWebhook, db.trustChange)
+	if err != nil {
+		return nil, fmt.Errorf("error marking spendable transactions: %v", err)
+	}
+	defer rows.Close()
+
+	var spendable []SpendableTransaction
+	for rows.Next() {
+		var tx SpendableTransaction
+		if err := rows.Scan(&tx.Address, &tx.TxHash, &tx.Amount, &tx.BlockHeight, &tx.Confirmations); err != nil {
+			return nil, fmt.Errorf("error scanning spendable transaction: %v", err)
+		}
+		spendable = append(spendable, tx)
+	}
+	return spendable, rows.Err()
+}
+
+// AddTransactionNote attaches a note to a transaction of a tracked address.
+// Returns nil if the address has no such transaction.
+func (db *DB) AddTransactionNote(address, txHash, note string) (*TransactionNote, error) {
+	var n TransactionNote
+	err := db.QueryRow(`
+		INSERT INTO transaction_notes (address_id, tx_hash, note)
+		SELECT a.id, t.tx_hash, $3
+		FROM transactions t
+		JOIN addresses a ON t.address_id = a.id
+		WHERE a.address = $1 AND t.tx_hash = $2
+		LIMIT 1
+		RETURNING id, tx_hash, note, created_at
+	`, address, txHash, note).Scan(&n.ID, &n.TxHash, &n.Note, &n.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error adding transaction note: %v", err)
+	}
+	return &n, nil
+}
+
+// GetTransactionNotes returns the notes on one transaction of a tracked address, oldest first
+func (db *DB) GetTransactionNotes(address, txHash string) ([]TransactionNote, error) {
+	return db.queryNotes(`
+		SELECT n.id, n.tx_hash, n.note, n.created_at
+		FROM transaction_notes n
+		JOIN addresses a ON n.address_id = a.id
+		WHERE a.address = $1 AND n.tx_hash = $2
+		ORDER BY n.created_at, n.id
+	`, address, txHash)
+}
+
+// GetAddressNotes returns all notes of a tracked address, keyed by tx hash
+func (db *DB) GetAddressNotes(addressID int64) (map[string][]TransactionNote, error) {
+	notes, err := db.queryNotes(`
+		SELECT id, tx_hash, note, created_at
+		FROM transaction_notes
+		WHERE address_id = $1
+		ORDER BY created_at, id
+	`, addressID)
+	if err != nil {
+		return nil, err
+	}
+	byTx := make(map[string][]TransactionNote)
+	for _, n := range notes {
+		byTx[n.TxHash] = append(byTx[n.TxHash], n)
+	}
+	return byTx, nil
+}
+
+func (db *DB) queryNotes(query string, args ...interface{}) ([]TransactionNote, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting transaction notes: %v", err)
+	}
+	defer rows.Close()
+
+	var notes []TransactionNote
+	for rows.Next() {
+		var n TransactionNote
+		if err := rows.Scan(&n.ID, &n.TxHash, &n.Note, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning transaction note: %v", err)
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
 }
@@ -0,0 +1,626 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+const doge = spec.KoinuPerDoge
+
+// testDB returns a database with the tracker's schema, created in a
+// Postgres schema of its own that is dropped when the test ends. The
+// server is given as a lib/pq connection string in DOGETRACKER_TEST_DB;
+// without it the test is skipped.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("DOGETRACKER_TEST_DB")
+	if dsn == "" {
+		t.Skip("DOGETRACKER_TEST_DB is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("dogetracker_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	var scoped string
+	switch {
+	case !strings.Contains(dsn, "://"):
+		scoped = dsn + " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		scoped = dsn + "&search_path=" + schema
+	default:
+		scoped = dsn + "?search_path=" + schema
+	}
+	conn, err := sql.Open("postgres", scoped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	db := &DB{DB: conn}
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// receive records an output paid to address at height, as processAddress does
+func receive(t *testing.T, db *DB, txHash, address string, amount spec.Amount, height int64) {
+	t.Helper()
+	if err := db.InsertTransaction(txHash, 0, address, amount, height, 1, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertUnspentTransaction(txHash, 0, address, amount, height, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unspent returns the tx hashes of an address's unspent outputs, oldest
+// first, and their total
+func unspent(t *testing.T, db *DB, address string) ([]string, spec.Amount) {
+	t.Helper()
+	utxos, err := db.GetUnspentOutputs(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := []string{}
+	var total spec.Amount
+	for _, u := range utxos {
+		hashes = append(hashes, fmt.Sprintf("%s@%d", u.TxHash, u.BlockHeight))
+		total += u.Amount
+	}
+	return hashes, total
+}
+
+// storedBalance returns the balance kept in the addresses table
+func storedBalance(t *testing.T, db *DB, address string) spec.Amount {
+	t.Helper()
+	var balance spec.Amount
+	if err := db.QueryRow("SELECT balance FROM addresses WHERE address = $1", address).Scan(&balance); err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+// Amounts are what the address received and never signed by direction, so
+// negative ones are refused before any query (db has no connection)
+func TestNegativeAmountsRejected(t *testing.T) {
+	db := &DB{}
+	for _, amount := range []spec.Amount{-1, -100 * spec.KoinuPerDoge} {
+		if err := db.InsertTransaction("a1", 0, "DTracked", amount, 100, 1, 0, 0, "", ""); err == nil {
+			t.Errorf("InsertTransaction(%s) succeeded, want an error", amount)
+		}
+		if err := db.InsertUnspentTransaction("a1", 0, "DTracked", amount, 100, 1); err == nil {
+			t.Errorf("InsertUnspentTransaction(%s) succeeded, want an error", amount)
+		}
+	}
+}
+
+func TestRewindRestoresSpentOutputs(t *testing.T) {
+	const address = "DTracked"
+	tests := []struct {
+		name        string
+		rewindTo    int64
+		wantUnspent []string
+	}{
+		{"spending block rolled back", 104, []string{"a1@100", "c1@101", "b1@103"}},
+		{"output created above the new tip stays gone", 102, []string{"a1@100", "c1@101"}},
+		{"spending block kept", 105, []string{"c1@101"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+				t.Fatal(err)
+			}
+			receive(t, db, "a1", address, 10*doge, 100)
+			receive(t, db, "c1", address, 1*doge, 101)
+			receive(t, db, "b1", address, 5*doge, 103)
+			// a1 and b1 are spent in block 105
+			for _, txHash := range []string{"a1", "b1"} {
+				if err := db.MarkTransactionSpent(txHash, 0, address, 105, "s1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := db.RefreshAddressBalance(address); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.RewindProcessedBlocks(tt.rewindTo, "hash"); err != nil {
+				t.Fatal(err)
+			}
+			got, total := unspent(t, db, address)
+			if !reflect.DeepEqual(got, tt.wantUnspent) {
+				t.Errorf("unspent outputs = %v, want %v", got, tt.wantUnspent)
+			}
+			if balance := storedBalance(t, db, address); balance != total {
+				t.Errorf("stored balance = %s, want %s", balance, total)
+			}
+		})
+	}
+}
+
+// A txid recurring at another height (pre-BIP30 duplicate coinbases) is a
+// distinct output, not a repeat of the first
+func TestDuplicateTxidAtTwoHeights(t *testing.T) {
+	const address = "DMiner"
+	db := testDB(t)
+	if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "coinbase", address, 10000*doge, 100)
+	receive(t, db, "coinbase", address, 10000*doge, 200)
+	// Recording a block again changes nothing
+	receive(t, db, "coinbase", address, 10000*doge, 100)
+
+	got, total := unspent(t, db, address)
+	if want := []string{"coinbase@100", "coinbase@200"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unspent outputs = %v, want %v", got, want)
+	}
+	if total != 20000*doge {
+		t.Errorf("unspent total = %s, want 20000", total)
+	}
+	var recorded int
+	if err := db.QueryRow("SELECT COUNT(*) FROM transactions WHERE tx_hash = 'coinbase'").Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != 2 {
+		t.Errorf("%d transactions recorded, want 2", recorded)
+	}
+
+	// Rolling back the later block leaves the earlier output alone
+	if err := db.RewindProcessedBlocks(150, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = unspent(t, db, address)
+	if want := []string{"coinbase@100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after the rewind unspent outputs = %v, want %v", got, want)
+	}
+}
+
+// A spend of a txid recorded at two heights takes one output, the one the
+// node's UTXO set held at the spend, and a rewind gives back just that one
+func TestSpendOneOfDuplicateTxids(t *testing.T) {
+	const address = "DMiner"
+	tests := []struct {
+		name        string
+		spentHeight int64
+		wantUnspent []string
+	}{
+		{"spent after both", 300, []string{"coinbase@100"}},
+		{"spent between them", 150, []string{"coinbase@200"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+				t.Fatal(err)
+			}
+			receive(t, db, "coinbase", address, 10000*doge, 100)
+			receive(t, db, "coinbase", address, 10000*doge, 200)
+			if err := db.MarkTransactionSpent("coinbase", 0, address, tt.spentHeight, "s1"); err != nil {
+				t.Fatal(err)
+			}
+			got, total := unspent(t, db, address)
+			if !reflect.DeepEqual(got, tt.wantUnspent) {
+				t.Errorf("unspent outputs = %v, want %v", got, tt.wantUnspent)
+			}
+			if total != 10000*doge {
+				t.Errorf("unspent total = %s, want 10000", total)
+			}
+
+			// Rolling back the spend restores the one output it took
+			if err := db.RewindProcessedBlocks(tt.spentHeight-1, "hash"); err != nil {
+				t.Fatal(err)
+			}
+			got, _ = unspent(t, db, address)
+			want := []string{"coinbase@100", "coinbase@200"}
+			if tt.spentHeight < 200 {
+				want = want[:1]
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("after the rewind unspent outputs = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// Concurrent writers each record an output and refresh the balance; the
+// stored balance must end up as the sum of all of them, never a stale one
+func TestConcurrentBalanceRefresh(t *testing.T) {
+	const address = "DTracked"
+	const writers = 20
+	db := testDB(t)
+	if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			txHash := fmt.Sprintf("tx%d", i)
+			if err := db.InsertUnspentTransaction(txHash, 0, address, spec.Amount(i+1)*doge, 100, 1); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := db.RefreshAddressBalance(address); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	want := spec.Amount(writers*(writers+1)/2) * doge
+	if balance := storedBalance(t, db, address); balance != want {
+		t.Errorf("stored balance = %s, want %s", balance, want)
+	}
+}
+
+func TestRequiredConfirmationsFor(t *testing.T) {
+	db := testDB(t)
+	tiers := `[{"min_amount": 1000, "required_confirmations": 6}, {"min_amount": 100000, "required_confirmations": 20}]`
+	tests := []struct {
+		base   int
+		tiers  interface{}
+		amount string
+		want   int
+	}{
+		{1, tiers, "10", 1},
+		{1, tiers, "999.99999999", 1},
+		{1, tiers, "1000", 6},
+		{1, tiers, "50000", 6},
+		{1, tiers, "100000", 20},
+		{1, tiers, "1000000", 20},
+		{3, tiers, "10", 3}, // below every tier: the address's own setting
+		{3, nil, "1000000", 3},
+		{0, nil, "10", 1},
+		{1, `[{"min_amount": 0, "required_confirmations": 0}]`, "10", 1},
+	}
+	for _, tt := range tests {
+		var got int
+		err := db.QueryRow(`SELECT required_confirmations_for($1, $2::JSONB, $3::NUMERIC)`, tt.base, tt.tiers, tt.amount).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("required_confirmations_for(%d, %v, %s) = %d, want %d", tt.base, tt.tiers, tt.amount, got, tt.want)
+		}
+	}
+}
+
+// Deposits become spendable at the confirmations of their amount's tier
+func TestSpendableByTier(t *testing.T) {
+	const address = "DExchange"
+	db := testDB(t)
+	err := db.TrackAddresses([]AddressConfig{{
+		Address:               address,
+		RequiredConfirmations: 1,
+		ConfirmationTiers: []ConfirmationTier{
+			{MinAmount: 1000, RequiredConfirmations: 6},
+			{MinAmount: 100000, RequiredConfirmations: 20},
+		},
+	}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "small", address, 10*doge, 100)
+	receive(t, db, "medium", address, 1000*doge, 100)
+	receive(t, db, "large", address, 200000*doge, 100)
+
+	tests := []struct {
+		tip  int64
+		want []string // newly spendable
+	}{
+		{100, []string{"small"}},
+		{104, nil},
+		{105, []string{"medium"}},
+		{118, nil},
+		{119, []string{"large"}},
+		{200, nil},
+	}
+	for _, tt := range tests {
+		if err := db.UpdateConfirmations(tt.tip); err != nil {
+			t.Fatal(err)
+		}
+		spendable, err := db.MarkSpendableTransactions(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, tx := range spendable {
+			got = append(got, tx.TxHash)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("at tip %d (%d confirmations) spendable = %v, want %v", tt.tip, tt.tip-99, got, tt.want)
+		}
+	}
+}
+
+// Reprocessing a block keeps what its transactions went through: a
+// deposit's spendable webhook does not fire again and archived
+// transactions stay archived
+func TestClearBlockKeepsState(t *testing.T) {
+	const address = "DTracked"
+	db := testDB(t)
+	if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "a1", address, 10*doge, 100)
+	receive(t, db, "b1", address, 5*doge, 100)
+	if err := db.MarkTransactionSpent("b1", 0, address, 101, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateConfirmations(101); err != nil {
+		t.Fatal(err)
+	}
+	if spendable, err := db.MarkSpendableTransactions(false); err != nil || len(spendable) != 2 {
+		t.Fatalf("spendable = %v, %v, want a1 and b1", spendable, err)
+	}
+	if archived, err := db.ArchiveTransactions(1); err != nil || archived != 1 {
+		t.Fatalf("archived %d, %v, want b1 only", archived, err)
+	}
+	var createdAt time.Time
+	if err := db.QueryRow("SELECT created_at FROM transactions WHERE tx_hash = 'a1'").Scan(&createdAt); err != nil {
+		t.Fatal(err)
+	}
+
+	cleared, err := db.ClearBlock(100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "a1", address, 10*doge, 100)
+	receive(t, db, "b1", address, 5*doge, 100)
+	if err := db.RestoreClearedTransactions(100, cleared); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateConfirmations(101); err != nil {
+		t.Fatal(err)
+	}
+	if spendable, err := db.MarkSpendableTransactions(false); err != nil || len(spendable) != 0 {
+		t.Errorf("spendable again = %v, %v, want none", spendable, err)
+	}
+	var hot, archived int
+	err = db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM transactions WHERE tx_hash = 'b1'),
+			(SELECT COUNT(*) FROM archived_transactions WHERE tx_hash = 'b1')
+	`).Scan(&hot, &archived)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hot != 0 || archived != 1 {
+		t.Errorf("b1 is in transactions %d times and archived %d times, want only archived", hot, archived)
+	}
+	var restoredAt time.Time
+	if err := db.QueryRow("SELECT created_at FROM transactions WHERE tx_hash = 'a1'").Scan(&restoredAt); err != nil {
+		t.Fatal(err)
+	}
+	if !restoredAt.Equal(createdAt) {
+		t.Errorf("a1 created_at = %v, want the original %v", restoredAt, createdAt)
+	}
+	if got, _ := unspent(t, db, address); !reflect.DeepEqual(got, []string{"a1@100"}) {
+		t.Errorf("unspent outputs = %v, want [a1@100]", got)
+	}
+}
+
+// UTXO count snapshots above a rewind go with the blocks they were taken
+// at, so the next snapshot compares against the count the chain still has
+func TestRewindDropsUTXOCountSnapshots(t *testing.T) {
+	const address = "DTracked"
+	db := testDB(t)
+	if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	receive(t, db, "a1", address, 10*doge, 100)
+	if err := db.RecordUTXOCountSnapshot(address, 100, at); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "b1", address, 5*doge, 105)
+	if err := db.RecordUTXOCountSnapshot(address, 105, at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.RewindProcessedBlocks(102, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	// One output again, as at height 100: nothing to record
+	if err := db.RecordUTXOCountSnapshot(address, 103, at.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query("SELECT height FROM utxo_count_snapshots ORDER BY height")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var heights []int64
+	for rows.Next() {
+		var height int64
+		if err := rows.Scan(&height); err != nil {
+			t.Fatal(err)
+		}
+		heights = append(heights, height)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{100}; !reflect.DeepEqual(heights, want) {
+		t.Errorf("snapshot heights = %v, want %v", heights, want)
+	}
+}
+
+// Reprocessing a block leaves alone the addresses it will not walk again
+// (a rescan that has not reached the block yet), so nothing of theirs is
+// lost
+func TestClearBlockKeepsAddresses(t *testing.T) {
+	db := testDB(t)
+	err := db.TrackAddresses([]AddressConfig{
+		{Address: "DWalked", RequiredConfirmations: 1},
+		{Address: "DKept", RequiredConfirmations: 1},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "a1", "DWalked", 10*doge, 100)
+	receive(t, db, "b1", "DKept", 5*doge, 99)
+	receive(t, db, "b2", "DKept", 2*doge, 100)
+	if err := db.MarkTransactionSpent("b1", 0, "DKept", 100, "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	cleared, err := db.ClearBlock(100, []string{"DKept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleared) != 1 || cleared[0].TxHash != "a1" {
+		t.Errorf("cleared = %v, want a1 only", cleared)
+	}
+	if got, _ := unspent(t, db, "DWalked"); len(got) != 0 {
+		t.Errorf("DWalked unspent outputs = %v, want none", got)
+	}
+	if got, _ := unspent(t, db, "DKept"); !reflect.DeepEqual(got, []string{"b2@100"}) {
+		t.Errorf("DKept unspent outputs = %v, want [b2@100]", got)
+	}
+	var recorded int
+	if err := db.QueryRow("SELECT COUNT(*) FROM transactions WHERE tx_hash = 'b2'").Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != 1 {
+		t.Errorf("b2 recorded %d times, want 1", recorded)
+	}
+}
+
+// A transaction's addresses are outgoing where it spent an output and
+// incoming where it paid one, though its spends are recorded under the
+// transactions that funded them
+func TestTransactionAddressesDirection(t *testing.T) {
+	db := testDB(t)
+	err := db.TrackAddresses([]AddressConfig{
+		{Address: "DSender", RequiredConfirmations: 1},
+		{Address: "DReceiver", RequiredConfirmations: 1},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "a1", "DSender", 10*doge, 100)
+	// s1 spends a1, pays DReceiver and returns change to DSender
+	if err := db.MarkTransactionSpent("a1", 0, "DSender", 101, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, db, "s1", "DReceiver", 6*doge, 101)
+	receive(t, db, "s1", "DSender", 3*doge, 101)
+
+	direction := func(txHash string) []string {
+		t.Helper()
+		addresses, err := db.GetTransactionAddresses(txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, ta := range addresses {
+			got = append(got, ta.Address+" "+ta.Direction)
+		}
+		return got
+	}
+	if got, want := direction("s1"), []string{"DSender incoming", "DSender outgoing", "DReceiver incoming"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("s1 addresses = %v, want %v", got, want)
+	}
+	if got, want := direction("a1"), []string{"DSender incoming"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a1 addresses = %v, want %v", got, want)
+	}
+}
+
+// Volume windows go by block time, so outputs recorded now from old blocks
+// (a rescan or catching up) stay out of a recent window
+func TestVolumeWindowByBlockTime(t *testing.T) {
+	const address = "DTracked"
+	db := testDB(t)
+	if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	blocks := []struct {
+		height int64
+		time   time.Time
+	}{{100, now.Add(-72 * time.Hour)}, {101, now.Add(-time.Hour)}, {102, now.Add(-30 * time.Minute)}}
+	for _, b := range blocks {
+		if err := db.SaveProcessedBlock(b.height, fmt.Sprintf("hash%d", b.height), b.time, b.time); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive(t, db, "a1", address, 10*doge, 100)
+	receive(t, db, "b1", address, 5*doge, 101)
+	receive(t, db, "c1", address, 1*doge, 101)
+	if err := db.MarkTransactionSpent("a1", 0, address, 102, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkTransactionSpent("b1", 0, address, 102, "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.GetAddressVolume(address, "24 hours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AddressVolume{Incoming: 6 * doge, IncomingCount: 2, Outgoing: 15 * doge, OutgoingCount: 2}
+	if *v != want {
+		t.Errorf("volume = %+v, want %+v", *v, want)
+	}
+}
+
+// An address's activity is timed by its blocks, not by when the tracker
+// recorded them
+func TestActivityBlockTime(t *testing.T) {
+	const address = "DTracked"
+	db := testDB(t)
+	if err := db.TrackAddresses([]AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+	last := first.Add(24 * time.Hour)
+	if err := db.SaveProcessedBlock(100, "hash100", first, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveProcessedBlock(200, "hash200", last, last); err != nil {
+		t.Fatal(err)
+	}
+	// Block 200 is recorded first, so recording time says nothing of the order
+	receive(t, db, "c1", address, 1*doge, 200)
+	receive(t, db, "b1", address, 5*doge, 100)
+	receive(t, db, "a1", address, 10*doge, 100)
+
+	gotFirst, gotLast, found, err := db.GetAddressActivity(address)
+	if err != nil || !found {
+		t.Fatalf("activity: found %v, %v", found, err)
+	}
+	if gotFirst.TxHash != "b1" || !gotFirst.Timestamp.Equal(first) {
+		t.Errorf("first = %s at %v, want b1 at %v", gotFirst.TxHash, gotFirst.Timestamp, first)
+	}
+	if gotLast.TxHash != "c1" || !gotLast.Timestamp.Equal(last) {
+		t.Errorf("last = %s at %v, want c1 at %v", gotLast.TxHash, gotLast.Timestamp, last)
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Reasons a transaction was removed from the tracked history
+const (
+	RemovedByRewind    = "rewind"    // its block was rolled back by a cursor rewind
+	RemovedByRescan    = "rescan"    // its address was rescanned from an earlier height
+	RemovedByReprocess = "reprocess" // its block was reprocessed and it was not found again
+)
+
+func (db *DB) initDroppedSchema() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS transaction_history (
+			id SERIAL PRIMARY KEY,
+			address_id INTEGER NOT NULL REFERENCES addresses(id),
+			tx_hash VARCHAR(64) NOT NULL,
+			amount DECIMAL(20,8) NOT NULL,
+			block_height INTEGER NOT NULL,
+			removal_reason VARCHAR(16) NOT NULL,
+			removed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating transaction_history table: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS transaction_history_address_idx
+		ON transaction_history (address_id, removed_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating transaction_history index: %v", err)
+	}
+	return nil
+}
+
+// removeTransactionsAbove moves the transactions (hot and archived) above
+// height into transaction_history, recording why they were removed.
+// An addressID of 0 removes them for every address.
+func removeTransactionsAbove(tx *sql.Tx, height int64, addressID int64, reason string) error {
+	for _, table := range []string{"transactions", "archived_transactions"} {
+		_, err := tx.Exec(fmt.Sprintf(`
+			WITH removed AS (
+				DELETE FROM %s
+				WHERE block_height > $1 AND ($3 = 0 OR address_id = $3)
+				RETURNING address_id, tx_hash, amount, block_height
+			)
+			INSERT INTO transaction_history (address_id, tx_hash, amount, block_height, removal_reason)
+			SELECT address_id, tx_hash, amount, block_height, $2::VARCHAR
+			FROM removed
+		`, table), height, reason, addressID)
+		if err != nil {
+			return fmt.Errorf("error removing %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// GetDroppedTransactions returns an address's removed transactions, newest first
+func (db *DB) GetDroppedTransactions(address string) ([]DroppedTransaction, error) {
+	rows, err := db.Query(`
+		SELECT h.tx_hash, h.amount, h.block_height, h.removal_reason, h.removed_at
+		FROM transaction_history h
+		JOIN addresses a ON h.address_id = a.id
+		WHERE a.address = $1
+		ORDER BY h.removed_at DESC, h.id DESC
+	`, address)
+	if err != nil {
+		return nil, fmt.Errorf("error getting dropped transactions: %v", err)
+	}
+	defer rows.Close()
+
+	var dropped []DroppedTransaction
+	for rows.Next() {
+		var d DroppedTransaction
+		if err := rows.Scan(&d.TxHash, &d.Amount, &d.BlockHeight, &d.RemovalReason, &d.RemovedAt); err != nil {
+			return nil, fmt.Errorf("error scanning dropped transaction: %v", err)
+		}
+		dropped = append(dropped, d)
+	}
+	return dropped, rows.Err()
+}
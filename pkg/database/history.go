@@ -0,0 +1,266 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+func (db *DB) initHistorySchema() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS balance_snapshots (
+			id SERIAL PRIMARY KEY,
+			address_id INTEGER NOT NULL REFERENCES addresses(id),
+			height INTEGER NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			balance DECIMAL(20,8) NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating balance_snapshots table: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS balance_snapshots_address_time_idx
+		ON balance_snapshots (address_id, timestamp)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating balance_snapshots index: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS utxo_count_snapshots (
+			id SERIAL PRIMARY KEY,
+			address_id INTEGER NOT NULL REFERENCES addresses(id),
+			height INTEGER NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			utxo_count INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating utxo_count_snapshots table: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS utxo_count_snapshots_address_time_idx
+		ON utxo_count_snapshots (address_id, timestamp)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating utxo_count_snapshots index: %v", err)
+	}
+	return nil
+}
+
+// RecordBalanceSnapshot stores an address's balance as of a block, unless
+// it is unchanged since the address's latest snapshot. Returns whether it
+// was stored, i.e. the balance changed.
+func (db *DB) RecordBalanceSnapshot(address string, height int64, timestamp time.Time, balance spec.Amount) (bool, error) {
+	res, err := db.Exec(`
+		INSERT INTO balance_snapshots (address_id, height, timestamp, balance)
+		SELECT a.id, $2::INTEGER, $3::TIMESTAMP, $4::DECIMAL
+		FROM addresses a
+		WHERE a.address = $1
+			AND $4::DECIMAL IS DISTINCT FROM (
+				SELECT s.balance FROM balance_snapshots s
+				WHERE s.address_id = a.id
+				ORDER BY s.height DESC, s.id DESC
+				LIMIT 1
+			)
+	`, address, height, timestamp, balance)
+	if err != nil {
+		return false, fmt.Errorf("error recording balance snapshot: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error recording balance snapshot: %v", err)
+	}
+	return n > 0, nil
+}
+
+// SetUTXOAlertThreshold makes RecordUTXOCountSnapshot queue a utxo_threshold
+// webhook event when an address's unspent output count rises to threshold
+// or above. Zero disables the alert.
+func (db *DB) SetUTXOAlertThreshold(threshold int) {
+	db.utxoAlert = threshold
+}
+
+// RecordUTXOCountSnapshot stores an address's unspent output count as of a
+// block, unless it is unchanged since the address's latest snapshot. If the
+// count crosses the UTXO alert threshold, a webhook event is queued in the
+// same statement.
+func (db *DB) RecordUTXOCountSnapshot(address string, height int64, timestamp time.Time) error {
+	_, err := db.Exec(`
+		WITH counts AS (
+			SELECT a.id, a.address,
+				(SELECT COUNT(*) FROM unspent_transactions ut WHERE ut.address_id = a.id) AS current,
+				(SELECT s.utxo_count FROM utxo_count_snapshots s
+				 WHERE s.address_id = a.id
+				 ORDER BY s.height DESC, s.id DESC
+				 LIMIT 1) AS previous
+			FROM addresses a
+			WHERE a.address = $1
+		),
+		recorded AS (
+			INSERT INTO utxo_count_snapshots (address_id, height, timestamp, utxo_count)
+			SELECT id, $2::INTEGER, $3::TIMESTAMP, current
+			FROM counts
+			WHERE current IS DISTINCT FROM previous
+		)
+		INSERT INTO webhook_outbox (event_type, address, tx_hash, amount, block_height, confirmations, utxo_count)
+		SELECT 'utxo_threshold', address, '', 0, $2::INTEGER, 0, current
+		FROM counts
+		WHERE $4 AND $5::INTEGER > 0 AND current >= $5::INTEGER AND COALESCE(previous, 0) < $5::INTEGER
+	`, address, height, timestamp, db.webhookOutbox, db.utxoAlert)
+	if err != nil {
+		return fmt.Errorf("error recording utxo count snapshot: %v", err)
+	}
+	return nil
+}
+
+// GetUTXOCountHistory returns an address's unspent output count at the end
+// of each interval ("hour", "day", "week" or "month") that has a snapshot,
+// oldest first
+func (db *DB) GetUTXOCountHistory(address string, interval string) ([]UTXOCountSnapshot, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (date_trunc($2, s.timestamp))
+			date_trunc($2, s.timestamp), s.height, s.utxo_count
+		FROM utxo_count_snapshots s
+		JOIN addresses a ON s.address_id = a.id
+		WHERE a.address = $1
+		ORDER BY date_trunc($2, s.timestamp), s.height DESC, s.id DESC
+	`, address, interval)
+	if err != nil {
+		return nil, fmt.Errorf("error getting utxo count history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []UTXOCountSnapshot
+	for rows.Next() {
+		var snap UTXOCountSnapshot
+		if err := rows.Scan(&snap.Timestamp, &snap.Height, &snap.UTXOCount); err != nil {
+			return nil, fmt.Errorf("error scanning utxo count snapshot: %v", err)
+		}
+		history = append(history, snap)
+	}
+	return history, rows.Err()
+}
+
+// GetBalanceHistory returns an address's balance at the end of each
+// interval ("hour", "day", "week" or "month") that has a snapshot, oldest first
+func (db *DB) GetBalanceHistory(address string, interval string) ([]BalanceSnapshot, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (date_trunc($2, s.timestamp))
+			date_trunc($2, s.timestamp), s.height, s.balance
+		FROM balance_snapshots s
+		JOIN addresses a ON s.address_id = a.id
+		WHERE a.address = $1
+		ORDER BY date_trunc($2, s.timestamp), s.height DESC, s.id DESC
+	`, address, interval)
+	if err != nil {
+		return nil, fmt.Errorf("error getting balance history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []BalanceSnapshot
+	for rows.Next() {
+		var snap BalanceSnapshot
+		if err := rows.Scan(&snap.Timestamp, &snap.Height, &snap.Balance); err != nil {
+			return nil, fmt.Errorf("error scanning balance snapshot: %v", err)
+		}
+		history = append(history, snap)
+	}
+	return history, rows.Err()
+}
+
+// GetAddressVolume returns an address's incoming and outgoing totals over
+// the window (a Postgres interval such as '24 hours'). Incoming outputs come
+// from the transactions and archive tables, outgoing ones from spent outputs;
+// both are timed by the block they are in (block times are stored in UTC).
+// Blocks processed before their time was stored fall back to when the
+// tracker recorded them.
+func (db *DB) GetAddressVolume(address string, window string) (*AddressVolume, error) {
+	var v AddressVolume
+	err := db.QueryRow(`
+		WITH addr AS (SELECT id FROM addresses WHERE address = $1),
+		incoming AS (
+			SELECT t.amount FROM transactions t
+			LEFT JOIN block_hashes b ON b.height = t.block_height
+			WHERE t.address_id = (SELECT id FROM addr) AND t.amount > 0
+				AND COALESCE(b.block_time >= (NOW() AT TIME ZONE 'UTC') - $2::INTERVAL,
+					t.created_at >= NOW() - $2::INTERVAL)
+			UNION ALL
+			SELECT t.amount FROM archived_transactions t
+			LEFT JOIN block_hashes b ON b.height = t.block_height
+			WHERE t.address_id = (SELECT id FROM addr) AND t.amount > 0
+				AND COALESCE(b.block_time >= (NOW() AT TIME ZONE 'UTC') - $2::INTERVAL,
+					t.created_at >= NOW() - $2::INTERVAL)
+		),
+		outgoing AS (
+			SELECT s.amount FROM spent_outputs s
+			LEFT JOIN block_hashes b ON b.height = s.spent_height
+			WHERE s.address_id = (SELECT id FROM addr)
+				AND COALESCE(b.block_time >= (NOW() AT TIME ZONE 'UTC') - $2::INTERVAL,
+					s.created_at >= NOW() - $2::INTERVAL)
+		)
+		SELECT
+			(SELECT COALESCE(SUM(amount), 0) FROM incoming),
+			(SELECT COUNT(*) FROM incoming),
+			(SELECT COALESCE(SUM(amount), 0) FROM outgoing),
+			(SELECT COUNT(*) FROM outgoing)
+	`, address, window).Scan(&v.Incoming, &v.IncomingCount, &v.Outgoing, &v.OutgoingCount)
+	if err != nil {
+		return nil, fmt.Errorf("error getting address volume: %v", err)
+	}
+	return &v, nil
+}
+
+// GetAddressActivity returns the first and last transactions received by an
+// address (including archived ones), either nil if it has none. found is
+// false if the address is not tracked.
+func (db *DB) GetAddressActivity(address string) (first, last *ActivityTransaction, found bool, err error) {
+	var addressID int64
+	err = db.QueryRow("SELECT id FROM addresses WHERE address = $1", address).Scan(&addressID)
+	if err == sql.ErrNoRows {
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("error getting address ID: %v", err)
+	}
+	if first, err = db.activityTransaction(addressID, false); err != nil {
+		return nil, nil, true, err
+	}
+	if last, err = db.activityTransaction(addressID, true); err != nil {
+		return nil, nil, true, err
+	}
+	return first, last, true, nil
+}
+
+// activityTransaction returns an address's earliest received transaction by
+// block height, or its latest one. Transactions in the same block are in
+// the order they were recorded, which is block order.
+func (db *DB) activityTransaction(addressID int64, latest bool) (*ActivityTransaction, error) {
+	order := "ASC"
+	if latest {
+		order = "DESC"
+	}
+	var t ActivityTransaction
+	err := db.QueryRow(fmt.Sprintf(`
+		SELECT t.tx_hash, t.block_height, COALESCE(b.block_time, t.created_at), t.amount FROM (
+			SELECT id, tx_hash, block_height, created_at, amount FROM transactions
+			WHERE address_id = $1 AND amount > 0
+			UNION ALL
+			SELECT id, tx_hash, block_height, created_at, amount FROM archived_transactions
+			WHERE address_id = $1 AND amount > 0
+		) t
+		LEFT JOIN block_hashes b ON b.height = t.block_height
+		ORDER BY t.block_height %[1]s, t.id %[1]s
+		LIMIT 1
+	`, order), addressID).Scan(&t.TxHash, &t.BlockHeight, &t.Timestamp, &t.Amount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting address activity: %v", err)
+	}
+	return &t, nil
+}
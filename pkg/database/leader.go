@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// leaderLockKey is the Postgres advisory lock held by the leading tracker
+const leaderLockKey = 0x646f6765 // "doge"
+
+/*
+ * LeaderLock elects one leader among tracker instances sharing a database,
+ * using a session-level Postgres advisory lock. The lock is held on a
+ * dedicated connection; if that connection dies the lock is released and
+ * another instance can take over.
+ */
+type LeaderLock struct {
+	db     *DB
+	conn   *sql.Conn // holds the lock while leading
+	leader atomic.Bool
+}
+
+func (db *DB) NewLeaderLock() *LeaderLock {
+	return &LeaderLock{db: db}
+}
+
+// IsLeader reports whether this instance currently holds the lock.
+func (l *LeaderLock) IsLeader() bool {
+	return l.leader.Load()
+}
+
+// Run tries to acquire the lock, and checks it is still held, every
+// interval until ctx is cancelled.
+func (l *LeaderLock) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if l.conn == nil {
+			l.acquire(ctx)
+		} else {
+			l.renew(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *LeaderLock) acquire(ctx context.Context) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		log.Printf("Leader election: error getting connection: %v", err)
+		return
+	}
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", leaderLockKey).Scan(&acquired)
+	if err != nil || !acquired {
+		if err != nil {
+			log.Printf("Leader election: error acquiring lock: %v", err)
+		}
+		conn.Close()
+		return
+	}
+	l.conn = conn
+	l.leader.Store(true)
+	log.Printf("Leader election: this instance is now the leader")
+}
+
+// renew checks the lock's connection is alive (and so the lock still held)
+func (l *LeaderLock) renew(ctx context.Context) {
+	if err := l.conn.PingContext(ctx); err == nil {
+		return
+	}
+	log.Printf("Leader election: lost the lock connection, standing by")
+	l.leader.Store(false)
+	l.conn.Close()
+	l.conn = nil
+}
+
+func (l *LeaderLock) release() {
+	if l.conn == nil {
+		return
+	}
+	l.leader.Store(false)
+	l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", leaderLockKey)
+	l.conn.Close()
+	l.conn = nil
+}
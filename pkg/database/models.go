@@ -2,6 +2,8 @@ package database
 
 import (
 	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
 )
 
 type Address struct {
@@ -10,27 +12,166 @@ type Address struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// AddressConfig is a tracked address and its settings, as exported/imported
+type AddressConfig struct {
+	Address               string             `json:"address"`
+	RequiredConfirmations int64              `json:"required_confirmations"`
+	ConfirmationTiers     []ConfirmationTier `json:"confirmation_tiers,omitempty"`
+}
+
+// ConfirmationTier overrides an address's required_confirmations for
+// transactions of at least MinAmount. The tier with the highest MinAmount
+// not above a transaction's amount applies.
+type ConfirmationTier struct {
+	MinAmount             float64 `json:"min_amount"`
+	RequiredConfirmations int64   `json:"required_confirmations"`
+}
+
 type Transaction struct {
-	ID            int64     `json:"id"`
-	TxHash        string    `json:"tx_hash"`
-	AddressID     int64     `json:"address_id"`
-	Amount        float64   `json:"amount"`
-	BlockHeight   int64     `json:"block_height"`
-	Confirmations int       `json:"confirmations"`
-	IsSpent       bool      `json:"is_spent"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int64       `json:"id"`
+	TxHash        string      `json:"tx_hash"`
+	AddressID     int64       `json:"address_id"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	IsSpent       bool        `json:"is_spent"`
+	IsDust        bool        `json:"is_dust"`
+	Size          *int        `json:"size"`
+	VSize         *int        `json:"vsize"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// TransactionDetail is one tracked address's record of a transaction
+type TransactionDetail struct {
+	Address       string      `json:"address"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	IsSpent       bool        `json:"is_spent"`
+	IsDust        bool        `json:"is_dust"`
+	Size          *int        `json:"size"`
+	VSize         *int        `json:"vsize"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Archived      bool        `json:"archived"`
+}
+
+// TransactionAddress is a tracked address touched by a transaction
+type TransactionAddress struct {
+	AddressID int64  `json:"address_id"`
+	Address   string `json:"address"`
+	Direction string `json:"direction"` // "incoming" or "outgoing"
 }
 
 type UnspentTransaction struct {
-	ID            int64     `json:"id"`
-	TxHash        string    `json:"tx_hash"`
-	AddressID     int64     `json:"address_id"`
-	Amount        float64   `json:"amount"`
-	BlockHeight   int64     `json:"block_height"`
-	Confirmations int       `json:"confirmations"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int64       `json:"id"`
+	TxHash        string      `json:"tx_hash"`
+	Vout          int         `json:"vout"` // -1 if recorded before output indexes were stored
+	AddressID     int64       `json:"address_id"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	IsDust        bool        `json:"is_dust"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+type TransactionNote struct {
+	ID        int64     `json:"id"`
+	TxHash    string    `json:"tx_hash"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DroppedTransaction is a transaction removed from an address's history
+type DroppedTransaction struct {
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	RemovalReason string      `json:"removal_reason"`
+	RemovedAt     time.Time   `json:"removed_at"`
+}
+
+// AddressChange is one entry of an address's change feed
+type AddressChange struct {
+	Seq           int64       `json:"seq"`
+	Kind          string      `json:"kind"` // ChangeTransaction, ChangeUnspent, ChangeSpent or ChangeRemoved
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	SpentHeight   *int64      `json:"spent_height,omitempty"`   // spent only
+	RemovalReason string      `json:"removal_reason,omitempty"` // removed only
+}
+
+// BalanceSnapshot is an address's balance as of a block
+type BalanceSnapshot struct {
+	Timestamp time.Time   `json:"timestamp"` // block time (start of the interval in history responses)
+	Height    int64       `json:"height"`
+	Balance   spec.Amount `json:"balance"`
+}
+
+// UTXOCountSnapshot is an address's unspent output count as of a block
+type UTXOCountSnapshot struct {
+	Timestamp time.Time `json:"timestamp"` // block time (start of the interval in history responses)
+	Height    int64     `json:"height"`
+	UTXOCount int       `json:"utxo_count"`
+}
+
+// ActivityTransaction is an address's first or last received transaction
+type ActivityTransaction struct {
+	TxHash      string      `json:"tx_hash"`
+	BlockHeight int64       `json:"block_height"`
+	Timestamp   time.Time   `json:"timestamp"` // block time (when the tracker recorded it for blocks processed before block times were stored)
+	Amount      spec.Amount `json:"amount"`
+}
+
+// AddressVolume is an address's incoming and outgoing totals over a window
+type AddressVolume struct {
+	Incoming      spec.Amount `json:"incoming"`
+	IncomingCount int         `json:"incoming_count"`
+	Outgoing      spec.Amount `json:"outgoing"`
+	OutgoingCount int         `json:"outgoing_count"`
+}
+
+// BlockAddress is what one tracked address received and spent in a block
+type BlockAddress struct {
+	Address  string      `json:"address"`
+	Received spec.Amount `json:"received"`
+	Sent     spec.Amount `json:"sent"`
+	Net      spec.Amount `json:"net"` // received - sent
+}
+
+// BlockAddresses are the tracked addresses a processed block touched
+type BlockAddresses struct {
+	Hash       string         `json:"hash"`
+	Height     int64          `json:"height"`
+	MedianTime *time.Time     `json:"median_time"` // median-time-past, if stored
+	Addresses  []BlockAddress `json:"addresses"`
+}
+
+// AddressBalance is a tracked address's balance split by confirmation
+type AddressBalance struct {
+	Address   string
+	Confirmed spec.Amount // outputs with at least required_confirmations
+	Pending   spec.Amount // outputs with fewer
+	Balance   spec.Amount // confirmed + pending
+}
+
+// WebhookEvent is an event in webhook_outbox
+type WebhookEvent struct {
+	ID            int64
+	Type          string
+	Address       string
+	TxHash        string
+	Amount        spec.Amount
+	BlockHeight   int64
+	Confirmations int
+	Suppressed    int  // caught_up events: spendable events not sent
+	UTXOCount     int  // utxo_threshold events: the address's unspent output count
+	Attempts      int  // failed delivery attempts so far
+	Replay        bool // re-sent by a notification replay
+	CreatedAt     time.Time
 }
 
 type ProcessedBlock struct {
@@ -39,3 +180,12 @@ type ProcessedBlock struct {
 	Hash        string    `json:"hash"`
 	ProcessedAt time.Time `json:"processed_at"`
 }
+
+// SpendableTransaction is a deposit that just reached its address's required_confirmations
+type SpendableTransaction struct {
+	Address       string      `json:"address"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func (db *DB) initOutboxSchema() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_outbox (
+			id BIGSERIAL PRIMARY KEY,
+			event_type VARCHAR(32) NOT NULL,
+			address VARCHAR(34) NOT NULL,
+			tx_hash VARCHAR(64) NOT NULL,
+			amount DECIMAL(20,8) NOT NULL,
+			block_height INTEGER NOT NULL,
+			confirmations INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			delivered_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating webhook_outbox table: %v", err)
+	}
+	_, err = db.Exec(`
+		ALTER TABLE webhook_outbox
+		ADD COLUMN IF NOT EXISTS suppressed INTEGER NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS utxo_count INTEGER NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS last_error TEXT,
+		ADD COLUMN IF NOT EXISTS dead_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS replay BOOLEAN NOT NULL DEFAULT FALSE
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding webhook_outbox columns: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS webhook_outbox_pending_idx
+		ON webhook_outbox (id) WHERE delivered_at IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating webhook_outbox index: %v", err)
+	}
+	return nil
+}
+
+// SetWebhookOutbox makes MarkSpendableTransactions queue a webhook event in
+// webhook_outbox for each transaction, in the same statement that marks it,
+// so an event is never lost between the two.
+func (db *DB) SetWebhookOutbox(enabled bool) {
+	db.webhookOutbox = enabled
+}
+
+// QueueWebhookEvent adds an event to webhook_outbox, if it is enabled
+func (db *DB) QueueWebhookEvent(e WebhookEvent) error {
+	if !db.webhookOutbox {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT INTO webhook_outbox (event_type, address, tx_hash, amount, block_height, confirmations, suppressed, utxo_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, e.Type, e.Address, e.TxHash, e.Amount, e.BlockHeight, e.Confirmations, e.Suppressed, e.UTXOCount)
+	if err != nil {
+		return fmt.Errorf("error queueing webhook event: %v", err)
+	}
+	return nil
+}
+
+// PendingWebhookEvents returns up to limit undelivered webhook events,
+// oldest first. Dead-lettered events are left out.
+func (db *DB) PendingWebhookEvents(limit int) ([]WebhookEvent, error) {
+	rows, err := db.Query(`
+		SELECT id, event_type, address, tx_hash, amount, block_height, confirmations, suppressed, utxo_count, replay, attempts, created_at
+		FROM webhook_outbox
+		WHERE delivered_at IS NULL AND dead_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pending webhook events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []WebhookEvent
+	for rows.Next() {
+		var e WebhookEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.Address, &e.TxHash, &e.Amount, &e.BlockHeight, &e.Confirmations, &e.Suppressed, &e.UTXOCount, &e.Replay, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning webhook event: %v", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// MarkWebhookDelivered records that webhook events were delivered
+func (db *DB) MarkWebhookDelivered(ids ...int64) error {
+	_, err := db.Exec(`UPDATE webhook_outbox SET delivered_at = NOW() WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error marking webhook event delivered: %v", err)
+	}
+	return nil
+}
+
+// RecordWebhookFailure counts a failed delivery attempt of a webhook event.
+// Once it has failed maxAttempts times (if positive) it is dead-lettered:
+// kept in webhook_outbox with dead_at set, but no longer delivered.
+// Returns whether it was dead-lettered.
+func (db *DB) RecordWebhookFailure(id int64, reason string, maxAttempts int) (bool, error) {
+	var dead bool
+	err := db.QueryRow(`
+		UPDATE webhook_outbox
+		SET attempts = attempts + 1,
+			last_error = $2,
+			dead_at = CASE WHEN $3::INTEGER > 0 AND attempts + 1 >= $3::INTEGER THEN NOW() END
+		WHERE id = $1
+		RETURNING dead_at IS NOT NULL
+	`, id, reason, maxAttempts).Scan(&dead)
+	if err != nil {
+		return false, fmt.Errorf("error recording webhook failure: %v", err)
+	}
+	return dead, nil
+}
+
+// GetSpendableEvents reconstructs the spendable events of deposits recorded
+// between from and to (including archived ones), oldest first, with their
+// current confirmations. address "" means every tracked address. At most
+// limit events are returned.
+func (db *DB) GetSpendableEvents(address string, from, to time.Time, limit int) ([]WebhookEvent, error) {
+	rows, err := db.Query(`
+		SELECT a.address, t.tx_hash, t.amount, t.block_height, t.confirmations, t.created_at
+		FROM (
+			SELECT address_id, tx_hash, amount, block_height, confirmations, created_at FROM transactions
+			WHERE spendable_notified AND amount > 0 AND created_at >= $2 AND created_at < $3
+			UNION ALL
+			SELECT address_id, tx_hash, amount, block_height, confirmations, created_at FROM archived_transactions
+			WHERE spendable_notified AND amount > 0 AND created_at >= $2 AND created_at < $3
+		) t
+		JOIN addresses a ON a.id = t.address_id
+		WHERE $1 = '' OR a.address = $1
+		ORDER BY t.created_at, t.block_height, t.tx_hash
+		LIMIT $4
+	`, address, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting spendable events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []WebhookEvent
+	for rows.Next() {
+		e := WebhookEvent{Type: "spendable", Replay: true}
+		if err := rows.Scan(&e.Address, &e.TxHash, &e.Amount, &e.BlockHeight, &e.Confirmations, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning spendable event: %v", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// QueueReplayEvents adds replayed events to webhook_outbox in one database
+// transaction, so a replay is queued entirely or not at all.
+func (db *DB) QueueReplayEvents(events []WebhookEvent) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO webhook_outbox (event_type, address, tx_hash, amount, block_height, confirmations, replay)
+		VALUES ($1, $2, $3, $4, $5, $6, TRUE)
+	`)
+	if err != nil {
+		return fmt.Errorf("error preparing insert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		if _, err := stmt.Exec(e.Type, e.Address, e.TxHash, e.Amount, e.BlockHeight, e.Confirmations); err != nil {
+			return fmt.Errorf("error queueing replayed event: %v", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReplicationLag returns how far a streaming replica is behind its primary,
+// measured from the last replayed transaction. ok is false when connected to
+// a primary (or the replica has replayed nothing yet).
+func (db *DB) ReplicationLag() (lag time.Duration, ok bool, err error) {
+	var seconds sql.NullFloat64
+	err = db.QueryRow(`
+		SELECT CASE WHEN pg_is_in_recovery()
+			THEN EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp())
+		END
+	`).Scan(&seconds)
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting replication lag: %v", err)
+	}
+	if !seconds.Valid {
+		return 0, false, nil
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), true, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// initTiersSchema adds per-address confirmation tiers and the SQL function
+// that picks the required confirmations for a transaction amount.
+func (db *DB) initTiersSchema() error {
+	// JSON array of {min_amount, required_confirmations} (NULL when unset)
+	_, err := db.Exec(`
+		ALTER TABLE addresses
+		ADD COLUMN IF NOT EXISTS confirmation_tiers JSONB
+	`)
+	if err != nil {
+		return fmt.Errorf("error adding confirmation_tiers column: %v", err)
+	}
+
+	// The tier with the highest min_amount not above the amount applies,
+	// otherwise the address's required_confirmations. Never below 1.
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION required_confirmations_for(base INTEGER, tiers JSONB, amount NUMERIC)
+		RETURNS INTEGER LANGUAGE SQL IMMUTABLE AS $$
+			SELECT GREATEST(COALESCE((
+				SELECT (tier->>'required_confirmations')::INTEGER
+				FROM jsonb_array_elements(COALESCE(tiers, '[]'::JSONB)) tier
+				WHERE (tier->>'min_amount')::NUMERIC <= amount
+				ORDER BY (tier->>'min_amount')::NUMERIC DESC
+				LIMIT 1
+			), base), 1)
+		$$
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating required_confirmations_for function: %v", err)
+	}
+	return nil
+}
+
+// tiersParam returns confirmation tiers as a query parameter: their JSON,
+// or NULL when there are none.
+func tiersParam(tiers []ConfirmationTier) (interface{}, error) {
+	if len(tiers) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(tiers)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding confirmation tiers: %v", err)
+	}
+	return string(data), nil
+}
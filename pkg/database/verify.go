@@ -0,0 +1,105 @@
+package database
+
+import (
+	"fmt"
+)
+
+// IntegrityIssue is one failed consistency check from Verify
+type IntegrityIssue struct {
+	Check    string // short name of the check
+	Count    int64  // number of offending rows
+	Repaired bool   // true if the repair statement was run
+}
+
+type integrityCheck struct {
+	name   string
+	count  string // SELECT COUNT(*) of offending rows
+	repair string // statement that fixes them (empty: report only)
+}
+
+// Rows counted "above the cursor" are left behind when processing was
+// interrupted or the chain reorganized below them.
+var integrityChecks = []integrityCheck{
+	{
+		name: "transactions referencing missing addresses",
+		count: `SELECT COUNT(*) FROM transactions t
+			LEFT JOIN addresses a ON t.address_id = a.id WHERE a.id IS NULL`,
+		repair: `DELETE FROM transactions t
+			WHERE NOT EXISTS (SELECT 1 FROM addresses a WHERE a.id = t.address_id)`,
+	},
+	{
+		name: "unspent outputs referencing missing addresses",
+		count: `SELECT COUNT(*) FROM unspent_transactions ut
+			LEFT JOIN addresses a ON ut.address_id = a.id WHERE a.id IS NULL`,
+		repair: `DELETE FROM unspent_transactions ut
+			WHERE NOT EXISTS (SELECT 1 FROM addresses a WHERE a.id = ut.address_id)`,
+	},
+	{
+		name: "unspent outputs whose amount differs from their transaction",
+		count: `SELECT COUNT(*) FROM unspent_transactions ut
+			JOIN transactions t ON t.address_id = ut.address_id AND t.tx_hash = ut.tx_hash AND t.block_height = ut.block_height
+			WHERE ut.amount <> t.amount`,
+		repair: `UPDATE unspent_transactions ut SET amount = t.amount, updated_at = NOW()
+			FROM transactions t
+			WHERE t.address_id = ut.address_id AND t.tx_hash = ut.tx_hash AND t.block_height = ut.block_height AND ut.amount <> t.amount`,
+	},
+	{
+		name: "unspent outputs without a transaction",
+		count: `SELECT COUNT(*) FROM unspent_transactions ut
+			WHERE NOT EXISTS (SELECT 1 FROM transactions t
+				WHERE t.address_id = ut.address_id AND t.tx_hash = ut.tx_hash AND t.block_height = ut.block_height)
+			AND NOT EXISTS (SELECT 1 FROM archived_transactions t
+				WHERE t.address_id = ut.address_id AND t.tx_hash = ut.tx_hash AND t.block_height = ut.block_height)`,
+	},
+	{
+		name: "transactions above the processed block cursor",
+		count: `SELECT COUNT(*) FROM transactions
+			WHERE block_height > (SELECT height FROM processed_blocks WHERE id = 1)`,
+		repair: `DELETE FROM transactions
+			WHERE block_height > (SELECT height FROM processed_blocks WHERE id = 1)`,
+	},
+	{
+		name: "unspent outputs above the processed block cursor",
+		count: `SELECT COUNT(*) FROM unspent_transactions
+			WHERE block_height > (SELECT height FROM processed_blocks WHERE id = 1)`,
+		repair: `DELETE FROM unspent_transactions
+			WHERE block_height > (SELECT height FROM processed_blocks WHERE id = 1)`,
+	},
+	// Must stay last: earlier repairs change the unspent outputs it sums.
+	{
+		name: "address balances that differ from the sum of unspent outputs",
+		count: `SELECT COUNT(*) FROM addresses a
+			WHERE a.balance <> (SELECT COALESCE(SUM(ut.amount), 0)
+				FROM unspent_transactions ut WHERE ut.address_id = a.id)`,
+		repair: `UPDATE addresses a SET balance = s.total, updated_at = NOW()
+			FROM (SELECT a2.id, COALESCE(SUM(ut.amount), 0) AS total
+				FROM addresses a2 LEFT JOIN unspent_transactions ut ON ut.address_id = a2.id
+				GROUP BY a2.id) s
+			WHERE a.id = s.id AND a.balance <> s.total`,
+	},
+}
+
+// Verify runs every integrity check and returns the ones that failed.
+// With repair set, checks that have a repair statement are fixed in place.
+// Only reads and writes the database; the node is not consulted.
+func (db *DB) Verify(repair bool) ([]IntegrityIssue, error) {
+	var issues []IntegrityIssue
+	for _, check := range integrityChecks {
+		var count int64
+		if err := db.QueryRow(check.count).Scan(&count); err != nil {
+			return issues, fmt.Errorf("error checking %s: %v", check.name, err)
+		}
+		if count == 0 {
+			continue
+		}
+		issue := IntegrityIssue{Check: check.name, Count: count}
+		if repair && check.repair != "" {
+			if _, err := db.Exec(check.repair); err != nil {
+				return issues, fmt.Errorf("error repairing %s: %v", check.name, err)
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/spec"
+	"github.com/dogeorg/dogetracker/pkg/util"
+)
+
+// Event types published by block processing
+const (
+	TxSeen         = "tx_seen"         // a transaction for a tracked address was recorded in a block
+	TxConfirmed    = "tx_confirmed"    // a deposit reached its address's required confirmations
+	Reorg          = "reorg"           // everything above Height was rolled back
+	BalanceChanged = "balance_changed" // an address's balance changed in a block
+	CaughtUp       = "caught_up"       // a catch-up pass reached the tip at Height
+)
+
+// Event is something that happened to the tracked addresses. Fields that
+// don't apply to its type are left zero.
+type Event struct {
+	Type       string
+	Address    string
+	TxHash     string
+	Amount     spec.Amount
+	Height     int64
+	Balance    spec.Amount // BalanceChanged: the new balance
+	Suppressed int         // CaughtUp: deposits that became spendable without a webhook event
+	Time       time.Time
+}
+
+/*
+ * Bus is an in-process publish/subscribe hub for tracker events, so block
+ * processing announces what happened once and each consumer (metrics,
+ * streams, audit logs, ...) subscribes on its own.
+ *
+ * Publishing never blocks: a subscriber whose channel is full misses the
+ * event. Consumers that can't lose events (the webhook) keep using the
+ * database outbox.
+ */
+type Bus struct {
+	util.ListenSet[Event]
+}
+
+// NewBus returns a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Publish announces an event to every subscriber. A nil bus drops it.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	b.Announce(event)
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// buffering up to capacity of them.
+func (b *Bus) Subscribe(capacity int) <-chan Event {
+	return b.Listen(capacity, true)
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Counter is a bus subscriber counting events per type, for /api/metrics.
+type Counter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// NewCounter returns a Counter with no events counted.
+func NewCounter() *Counter {
+	return &Counter{counts: make(map[string]uint64)}
+}
+
+// Run counts the events received from events until ctx is cancelled.
+func (c *Counter) Run(ctx context.Context, events <-chan Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			c.mu.Lock()
+			c.counts[event.Type]++
+			c.mu.Unlock()
+		}
+	}
+}
+
+// EventCounts returns the number of events seen per type since startup.
+func (c *Counter) EventCounts() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]uint64, len(c.counts))
+	for t, n := range c.counts {
+		counts[t] = n
+	}
+	return counts
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultWindow = 1024
+
+/*
+ * Latency keeps a rolling window of recent durations per key
+ * (e.g. per API route) and reports percentiles over that window.
+ *
+ * Thread-safe, can be shared across Goroutines.
+ */
+type Latency struct {
+	window  int
+	samples map[string]*ring
+	lock    sync.Mutex
+}
+
+type ring struct {
+	values []time.Duration
+	next   int
+	count  uint64 // total observations, including those that fell out of the window
+}
+
+// LatencySummary is a snapshot of one key's latency distribution.
+type LatencySummary struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// NewLatency returns a Latency tracker keeping the last `window` samples per key.
+func NewLatency(window int) *Latency {
+	if window <= 0 {
+		window = defaultWindow
+	}
+	return &Latency{window: window, samples: make(map[string]*ring)}
+}
+
+// Observe records one duration for key.
+func (l *Latency) Observe(key string, d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	r, ok := l.samples[key]
+	if !ok {
+		r = &ring{values: make([]time.Duration, 0, l.window)}
+		l.samples[key] = r
+	}
+	if len(r.values) < l.window {
+		r.values = append(r.values, d)
+	} else {
+		r.values[r.next] = d
+	}
+	r.next = (r.next + 1) % l.window
+	r.count++
+}
+
+// Snapshot returns the current percentiles for every key.
+func (l *Latency) Snapshot() map[string]LatencySummary {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	result := make(map[string]LatencySummary, len(l.samples))
+	for key, r := range l.samples {
+		sorted := make([]time.Duration, len(r.values))
+		copy(sorted, r.values)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		result[key] = LatencySummary{
+			Count: r.count,
+			P50:   millis(percentile(sorted, 0.50)),
+			P90:   millis(percentile(sorted, 0.90)),
+			P99:   millis(percentile(sorted, 0.99)),
+			Max:   millis(percentile(sorted, 1.0)),
+		}
+	}
+	return result
+}
+
+// percentile expects sorted samples (nearest-rank method)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/metrics"
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+const (
+	EventSpendable = "spendable"      // deposit reached its address's required_confirmations
+	EventCaughtUp  = "caught_up"      // finished catching up; replaces the spendable events of the catch-up
+	EventUTXOCount = "utxo_threshold" // address's unspent output count reached the alert threshold
+
+	DefaultWebhookTimeout = 10 * time.Second
+
+	webhookDialTimeout = 5 * time.Second
+)
+
+// Event is a notification about a tracked address.
+type Event struct {
+	Type          string      `json:"type"`
+	Address       string      `json:"address"`
+	TxHash        string      `json:"tx_hash"`
+	Amount        spec.Amount `json:"amount"`
+	BlockHeight   int64       `json:"block_height"`
+	Confirmations int         `json:"confirmations"`
+	Suppressed    int         `json:"suppressed,omitempty"` // caught_up: spendable events not sent
+	UTXOCount     int         `json:"utxo_count,omitempty"` // utxo_threshold: unspent output count
+	Replay        bool        `json:"replay,omitempty"`     // re-sent by a notification replay
+	Time          time.Time   `json:"time"`
+}
+
+/*
+ * Notifier POSTs events as JSON to a webhook URL, if configured.
+ *
+ * Webhook events are written to the database outbox together with the
+ * change that caused them, and a delivery worker sends them in order with
+ * Deliver, so none are lost when the tracker restarts or the webhook is
+ * down. In-process consumers subscribe to the events.Bus instead.
+ */
+type Notifier struct {
+	webhookURL string
+	client     *http.Client
+	latency    *metrics.Latency
+	delivered  atomic.Uint64
+	failed     atomic.Uint64
+}
+
+// NewNotifier returns a Notifier POSTing to webhookURL (if not empty), with
+// each delivery attempt bounded by timeout.
+func NewNotifier(webhookURL string, timeout time.Duration) *Notifier {
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	// A dedicated transport, so the webhook's connections are reused and a
+	// host that doesn't accept connections fails fast
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   webhookDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: webhookDialTimeout,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &Notifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: timeout, Transport: transport},
+		latency:    metrics.NewLatency(0),
+	}
+}
+
+// WebhookStats summarizes webhook delivery attempts since startup, counted
+// per event (a batch counts once per event it carries).
+type WebhookStats struct {
+	Delivered   uint64                 `json:"delivered"`
+	Failed      uint64                 `json:"failed"`
+	FailureRate float64                `json:"failure_rate"` // failed / attempts
+	Latency     metrics.LatencySummary `json:"latency"`
+}
+
+// WebhookStats returns delivery counts and attempt latency.
+func (n *Notifier) WebhookStats() WebhookStats {
+	stats := WebhookStats{
+		Delivered: n.delivered.Load(),
+		Failed:    n.failed.Load(),
+		Latency:   n.latency.Snapshot()["webhook"],
+	}
+	if attempts := stats.Delivered + stats.Failed; attempts > 0 {
+		stats.FailureRate = float64(stats.Failed) / float64(attempts)
+	}
+	return stats
+}
+
+// WebhookEnabled reports whether a webhook URL is configured.
+func (n *Notifier) WebhookEnabled() bool {
+	return n.webhookURL != ""
+}
+
+// Deliver POSTs an event to the webhook. A nil error means the webhook
+// accepted it with a 2xx status.
+func (n *Notifier) Deliver(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %v", err)
+	}
+	return n.deliver(payload, 1)
+}
+
+// DeliverBatch POSTs events to the webhook in one request, as a JSON array
+// in the given order. A nil error means the webhook accepted them all.
+func (n *Notifier) DeliverBatch(events []Event) error {
+	payload, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("marshal events: %v", err)
+	}
+	return n.deliver(payload, len(events))
+}
+
+// deliver POSTs a payload of count events, recording the outcome
+func (n *Notifier) deliver(payload []byte, count int) error {
+	start := time.Now()
+	err := n.post(payload)
+	n.latency.Observe("webhook", time.Since(start))
+	if err != nil {
+		n.failed.Add(uint64(count))
+		return err
+	}
+	n.delivered.Add(uint64(count))
+	return nil
+}
+
+func (n *Notifier) post(payload []byte) error {
+	res, err := n.client.Post(n.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook status code: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package spec
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KoinuPerDoge is the number of koinu (the smallest unit) in one DOGE
+const KoinuPerDoge = 100_000_000
+
+// Amount is a DOGE amount in koinu. Keeping it an integer keeps amounts
+// read from the node or the database exact; as a float64 most decimals are
+// only approximated.
+type Amount int64
+
+// ParseAmount parses a plain decimal DOGE amount ("123.45678901") exactly.
+// Fractions, exponents and more than 8 decimal places are rejected.
+func ParseAmount(s string) (Amount, error) {
+	digits := strings.TrimPrefix(s, "-")
+	whole, frac, hasFrac := strings.Cut(digits, ".")
+	if !isDigits(whole) || hasFrac && !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > 8 {
+		return 0, fmt.Errorf("amount %q has more than 8 decimal places", s)
+	}
+	koinu, err := strconv.ParseInt(whole+frac+strings.Repeat("0", 8-len(frac)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	if len(digits) < len(s) {
+		koinu = -koinu
+	}
+	return Amount(koinu), nil
+}
+
+// isDigits reports whether s is one or more ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount in DOGE with 8 decimal places.
+func (a Amount) String() string {
+	sign := ""
+	koinu := uint64(a)
+	if a < 0 {
+		sign = "-"
+		koinu = uint64(-a)
+	}
+	return fmt.Sprintf("%s%d.%08d", sign, koinu/KoinuPerDoge, koinu%KoinuPerDoge)
+}
+
+// MarshalJSON writes the amount as a DOGE number without trailing zeros.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	s := strings.TrimRight(a.String(), "0")
+	return []byte(strings.TrimSuffix(s, ".")), nil
+}
+
+// UnmarshalJSON reads a DOGE number or decimal string.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Set parses a decimal DOGE amount, so an Amount can be a command-line flag.
+func (a *Amount) Set(s string) error {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Scan reads a DECIMAL column, which the driver returns as text.
+func (a *Amount) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return a.scanString(string(src))
+	case string:
+		return a.scanString(src)
+	case int64:
+		*a = Amount(src * KoinuPerDoge)
+		return nil
+	case nil:
+		return errors.New("cannot scan NULL into Amount")
+	}
+	return fmt.Errorf("cannot scan %T into Amount", src)
+}
+
+func (a *Amount) scanString(s string) error {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value writes the amount as a DOGE decimal.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
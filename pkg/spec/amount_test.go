@@ -0,0 +1,97 @@
+package spec
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Amount
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1", KoinuPerDoge, true},
+		{"0.00000001", 1, true},
+		{"123.45678901", 12345678901, true},
+		{"0.1", 10000000, true},
+		{"92233720368.54775807", 9223372036854775807, true},
+		{"-2.5", -250000000, true},
+		{"-0.00000001", -1, true},
+		{"007.5", 750000000, true},
+		{"1e-8", 0, false},
+		{"1e3", 0, false},
+		{"1E3", 0, false},
+		{"1/2", 0, false},
+		{"0x10", 0, false},
+		{"+1", 0, false},
+		{".5", 0, false},
+		{"1.", 0, false},
+		{"--1", 0, false},
+		{" 1", 0, false},
+		{"1_000", 0, false},
+		{"-92233720368.54775808", 0, false},
+		{"0.000000001", 0, false},
+		{"92233720368.54775808", 0, false},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"NaN", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d, ok %v", tt.s, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAmountFormatting(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		str    string
+		json   string
+	}{
+		{0, "0.00000000", "0"},
+		{1, "0.00000001", "0.00000001"},
+		{10000000, "0.10000000", "0.1"},
+		{12345678901, "123.45678901", "123.45678901"},
+		{100 * KoinuPerDoge, "100.00000000", "100"},
+		{-250000000, "-2.50000000", "-2.5"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.str {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.amount, got, tt.str)
+		}
+		data, err := json.Marshal(tt.amount)
+		if err != nil || string(data) != tt.json {
+			t.Errorf("json.Marshal(Amount(%d)) = %s, %v, want %s", tt.amount, data, err, tt.json)
+		}
+		var back Amount
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.amount {
+			t.Errorf("json.Unmarshal(%s) = %d, %v, want %d", data, back, err, tt.amount)
+		}
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+		ok   bool
+	}{
+		{[]byte("0.30000000"), 30000000, true}, // 0.1 + 0.2 as a DECIMAL
+		{"1000000000.00000001", 100000000000000001, true},
+		{int64(5), 5 * KoinuPerDoge, true},
+		{nil, 0, false},
+		{[]byte("0.123456789"), 0, false},
+		{1.5, 0, false},
+	}
+	for _, tt := range tests {
+		var got Amount
+		err := got.Scan(tt.src)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Scan(%v) = %d, %v, want %d, ok %v", tt.src, got, err, tt.want, tt.ok)
+		}
+	}
+}
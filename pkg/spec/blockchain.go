@@ -12,9 +12,18 @@ type Blockchain interface {
 
 // Transaction represents a Dogecoin transaction
 type Transaction struct {
-	Hash    string  `json:"hash"`
-	Amount  float64 `json:"amount"`
-	IsSpent bool    `json:"is_spent"`
+	Hash    string `json:"hash"`
+	Vout    int    `json:"vout"` // index of the address's output in Hash
+	Amount  Amount `json:"amount"`
+	Size    int    `json:"size"`               // serialized size in bytes (0 if unknown)
+	VSize   int    `json:"vsize"`              // virtual size, as the node reports it (0 if unknown)
+	IsSpent bool   `json:"is_spent"`           // a spend of the address's output of Hash, not an output
+	SpentBy string `json:"spent_by,omitempty"` // for spends: the spending transaction
+
+	// For received outputs: the scriptPubKey hex and its type as the node
+	// reports it (pubkeyhash, scripthash, ...)
+	Script     string `json:"script,omitempty"`
+	ScriptType string `json:"script_type,omitempty"`
 }
 
 // BlockHeader from Dogecoin Core
@@ -37,3 +46,17 @@ type BlockHeader struct {
 	NextBlockHash     string  `json:"nextblockhash"`     // (string) The hash of the next block (hex)
 	NTx               int32   `json:"ntx"`               // Number of transactions in the block
 }
+
+// MerkleProof proves a transaction's inclusion in a block: double SHA-256
+// hashing the txid with each Branch hash in turn (on the left when that bit
+// of Index is 1, otherwise on the right; all in internal, byte-reversed
+// order) gives MerkleRoot, which is committed to by Header.
+type MerkleProof struct {
+	TxID        string   `json:"txid"`
+	BlockHash   string   `json:"block_hash"`
+	BlockHeight int64    `json:"block_height"`
+	Header      string   `json:"header"` // serialized 80-byte block header (hex)
+	Index       int      `json:"index"`  // position of the transaction in the block
+	Branch      []string `json:"branch"` // sibling hashes, leaf to root
+	MerkleRoot  string   `json:"merkle_root"`
+}
@@ -0,0 +1,40 @@
+// Package version holds build information, set at build time with:
+//
+//	go build -ldflags "-X github.com/dogeorg/dogetracker/pkg/version.Version=v1.2.3 \
+//	  -X github.com/dogeorg/dogetracker/pkg/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/dogeorg/dogetracker/pkg/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info is the build information reported by /api/version
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String formats the build information for logs
+func String() string {
+	return fmt.Sprintf("dogetracker %s (commit %s, built %s, %s)", Version, Commit, BuildTime, runtime.Version())
+}
@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,7 +16,19 @@ import (
 	"github.com/dogeorg/dogetracker/pkg/chaser"
 	"github.com/dogeorg/dogetracker/pkg/core"
 	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/events"
+	"github.com/dogeorg/dogetracker/pkg/notify"
 	"github.com/dogeorg/dogetracker/pkg/spec"
+	"github.com/dogeorg/dogetracker/pkg/version"
+)
+
+const (
+	archiveInterval = 10 * time.Minute
+	leaderInterval  = 5 * time.Second // leader lock acquire/renew period
+
+	maxStartupBackoff = 16 * time.Second // between database/node connection attempts
+
+	eventBuffer = 1000 // internal events a subscriber can fall behind by
 )
 
 type Config struct {
@@ -22,25 +36,67 @@ type Config struct {
 	rpcPort   int
 	rpcUser   string
 	rpcPass   string
+	breakerN  int
+	breakerT  time.Duration
 	zmqHost   string
 	zmqPort   int
+	zmqOpts   core.ZMQOptions
+	noZMQ     bool
+	poll      time.Duration
+	verifyPoW bool
+	readOnly  bool
 	batchSize int
 	dbHost    string
 	dbPort    int
 	dbUser    string
 	dbPass    string
 	dbName    string
+	dbReplica string
 	apiPort   int
+	apiSocket string
 	apiToken  string
+	apiLog    string
+	apiCase   string
+	apiAmtStr bool
+	apiAdmin  string
+	maxAddrs  int
+	maxBody   int64
+	webhook   string
+	utxoAlert int
+	hookWait  time.Duration
+	hookRetry webhookRetry
+	hookBatch webhookBatching
+	catchUp   int64
+	deferBal  bool
+	archive   int64
+	dust      spec.Amount
+	trusted   bool
+	shards    int
+	leader    bool
+	wait      time.Duration
 }
 
-func processBlock(ctx context.Context, db *database.DB, blockchain spec.Blockchain, height int64) error {
+// processBlock records the tracked addresses' transactions in the block at
+// height. tip is the chain tip height, which confirmations are counted from.
+// With deferBalances the stored balances are left for RefreshAllBalances.
+func processBlock(ctx context.Context, db *database.DB, blockchain spec.Blockchain, bus *events.Bus, height, tip int64, shards int, skip map[string]bool, deferBalances bool) error {
 	// Get block hash
 	hash, err := blockchain.GetBlockHash(height)
 	if err != nil {
 		return fmt.Errorf("error getting block hash: %v", err)
 	}
 
+	// Skip a block that was just processed: it is being delivered twice,
+	// e.g. by another instance sharing the database without -leader-election
+	last, err := db.GetLastProcessedBlock()
+	if err != nil {
+		return err
+	}
+	if alreadyProcessed(last, height, hash) {
+		log.Printf("Warning: block %d (%s) was already processed, skipping", height, hash)
+		return nil
+	}
+
 	// Get block header
 	header, err := blockchain.GetBlockHeader(hash)
 	if err != nil {
@@ -49,78 +105,329 @@ func processBlock(ctx context.Context, db *database.DB, blockchain spec.Blockcha
 
 	log.Printf("Processing block %d (%s) with %d transactions", height, hash, header.NTx)
 
-	// Get tracked addresses
-	addresses, err := db.GetTrackedAddresses()
+	// Get tracked addresses, except those being rescanned
+	tracked, err := db.GetTrackedAddresses()
 	if err != nil {
 		return fmt.Errorf("error getting tracked addresses: %v", err)
 	}
+	addresses := tracked[:0]
+	for _, addr := range tracked {
+		if !skip[addr] {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	// Process each address. Addresses are independent (every write is scoped
+	// to one address), so with shards > 1 they are split into that many
+	// groups processed concurrently.
+	// If the node could not be asked about an address the block is not
+	// saved, so the whole block is retried on the next pass.
+	blockTime := time.Unix(int64(header.Time), 0).UTC()
+	var fetchErr error
+	if shards <= 1 {
+		for _, addr := range addresses {
+			if err := processAddress(db, blockchain, bus, addr, height, tip, blockTime, deferBalances); err != nil {
+				fetchErr = err
+				break
+			}
+		}
+	} else {
+		var wg sync.WaitGroup
+		var errMu sync.Mutex
+		for shard := 0; shard < shards; shard++ {
+			wg.Add(1)
+			go func(shard int) {
+				defer wg.Done()
+				for i := shard; i < len(addresses); i += shards {
+					if err := processAddress(db, blockchain, bus, addresses[i], height, tip, blockTime, deferBalances); err != nil {
+						errMu.Lock()
+						fetchErr = err
+						errMu.Unlock()
+						return
+					}
+				}
+			}(shard)
+		}
+		wg.Wait()
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+
+	// Save processed block
+	err = db.SaveProcessedBlock(height, hash, blockTime, time.Unix(int64(header.MedianTime), 0).UTC())
+	if err != nil {
+		return fmt.Errorf("error saving processed block: %v", err)
+	}
+
+	return nil
+}
 
-	// Process each address
-	for _, addr := range addresses {
-		// Get raw transactions for this address
-		txs, err := blockchain.GetAddressTransactions(addr, height)
+// processAddress records one address's transactions in a block and updates its balance.
+// It only returns an error when the transactions could not be fetched from the node.
+func processAddress(db *database.DB, blockchain spec.Blockchain, bus *events.Bus, addr string, height, tip int64, blockTime time.Time, deferBalance bool) error {
+	// Get raw transactions for this address
+	txs, err := blockchain.GetAddressTransactions(addr, height)
+	if err != nil {
+		return fmt.Errorf("error getting transactions for address %s: %v", addr, err)
+	}
+
+	confirmations := confirmationsFromTip(height, tip)
+
+	// Transactions that spent from the address: their outputs to it are change
+	spenders := make(map[string]bool)
+	for _, tx := range txs {
+		if tx.SpentBy != "" {
+			spenders[tx.SpentBy] = true
+		}
+	}
+
+	// Process each transaction
+	for _, tx := range txs {
+		// Insert transaction into database
+		err = db.InsertTransaction(tx.Hash, tx.Vout, addr, tx.Amount, height, confirmations, tx.Size, tx.VSize, tx.Script, tx.ScriptType)
 		if err != nil {
-			log.Printf("Error getting transactions for address %s: %v", addr, err)
+			log.Printf("Error inserting transaction %s: %v", tx.Hash, err)
 			continue
 		}
+		bus.Publish(events.Event{Type: events.TxSeen, Address: addr, TxHash: tx.Hash, Amount: tx.Amount, Height: height})
 
-		// Process each transaction
-		for _, tx := range txs {
-			// Insert transaction into database
-			err = db.InsertTransaction(tx.Hash, addr, tx.Amount, height)
+		// Transactions are in block order, so an output is added before any
+		// spend of it, even by a later transaction in the same block, and a
+		// spend moves it from unspent_transactions to spent_outputs
+		if tx.IsSpent {
+			err = db.MarkTransactionSpent(tx.Hash, tx.Vout, addr, height, tx.SpentBy)
 			if err != nil {
-				log.Printf("Error inserting transaction %s: %v", tx.Hash, err)
+				log.Printf("Error marking transaction %s as spent: %v", tx.Hash, err)
 				continue
 			}
+		} else {
+			// Add to unspent transactions
+			err = db.InsertUnspentTransaction(tx.Hash, tx.Vout, addr, tx.Amount, height, confirmations)
+			if err != nil {
+				log.Printf("Error inserting unspent transaction %s: %v", tx.Hash, err)
+				continue
+			}
+		}
 
-			// If transaction is spent, remove it from unspent_transactions
-			if tx.IsSpent {
-				err = db.MarkTransactionSpent(tx.Hash)
-				if err != nil {
-					log.Printf("Error marking transaction %s as spent: %v", tx.Hash, err)
-					continue
-				}
-			} else {
-				// Add to unspent transactions
-				err = db.InsertUnspentTransaction(tx.Hash, addr, tx.Amount, height)
-				if err != nil {
-					log.Printf("Error inserting unspent transaction %s: %v", tx.Hash, err)
-					continue
-				}
+		if tx.Amount > 0 && spenders[tx.Hash] {
+			if err := db.MarkChange(tx.Hash, addr, height); err != nil {
+				log.Printf("Error marking change %s: %v", tx.Hash, err)
 			}
+		}
 
-			// Update address balance
-			balance, err := db.GetAddressBalance(addr)
-			if err != nil {
-				log.Printf("Error getting balance for address %s: %v", addr, err)
+		// Update address balance
+		if deferBalance {
+			continue
+		}
+		if _, err := db.RefreshAddressBalance(addr); err != nil {
+			log.Printf("Error updating balance for address %s: %v", addr, err)
+			continue
+		}
+	}
+
+	// Record the balance for the history time series (only stored if it changed)
+	if len(txs) > 0 {
+		balance, err := db.GetAddressBalance(addr)
+		if err != nil {
+			log.Printf("Error getting balance for address %s: %v", addr, err)
+			return nil
+		}
+		changed, err := db.RecordBalanceSnapshot(addr, height, blockTime, balance)
+		if err != nil {
+			log.Printf("Error recording balance snapshot for address %s: %v", addr, err)
+		}
+		if changed {
+			bus.Publish(events.Event{Type: events.BalanceChanged, Address: addr, Height: height, Balance: balance})
+		}
+		if err := db.RecordUTXOCountSnapshot(addr, height, blockTime); err != nil {
+			log.Printf("Error recording utxo count snapshot for address %s: %v", addr, err)
+		}
+	}
+	return nil
+}
+
+// alreadyProcessed reports whether the block at height with hash is the
+// last one processed, i.e. it is being delivered again. A different block
+// at the same height (after a rewind) is not.
+func alreadyProcessed(last *database.ProcessedBlock, height int64, hash string) bool {
+	return last != nil && last.Height == height && last.Hash == hash
+}
+
+// confirmationsFromTip counts a block's confirmations from the chain tip,
+// not from the block being processed, so blocks processed during a
+// catch-up are not reported as 1-confirmation until the pass ends. A block
+// above a stale tip has 1.
+func confirmationsFromTip(height, tip int64) int {
+	if tip > height {
+		return int(tip - height + 1)
+	}
+	return 1
+}
+
+// waitFor calls connect until it succeeds or timeout has passed, backing off
+// between attempts, so the tracker can start before its dependencies are up.
+func waitFor(what string, timeout time.Duration, connect func() error) error {
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+	for {
+		err := connect()
+		if err == nil || time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		log.Printf("Waiting for %s (retrying in %s): %v", what, backoff, err)
+		time.Sleep(backoff)
+		if backoff < maxStartupBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// resolveStartBlock parses -start-block: a block height, a block hash,
+// or a negative offset from the current tip (e.g. -1000)
+func resolveStartBlock(blockchain spec.Blockchain, startBlock string) (int64, error) {
+	height, err := strconv.ParseInt(startBlock, 10, 64)
+	if err != nil {
+		// Not a number, must be a block hash
+		if len(startBlock) != 64 {
+			return 0, fmt.Errorf("expecting a block height, block hash or negative offset")
+		}
+		header, err := blockchain.GetBlockHeader(startBlock)
+		if err != nil {
+			return 0, fmt.Errorf("error getting block header: %v", err)
+		}
+		return header.Height, nil
+	}
+	if height >= 0 {
+		return height, nil
+	}
+
+	// Negative: offset back from the current tip
+	tip, err := blockchain.GetBlockCount()
+	if err != nil {
+		return 0, fmt.Errorf("error getting block count: %v", err)
+	}
+	height = tip + height
+	if height < 0 {
+		return 0, fmt.Errorf("offset goes below the genesis block (tip is %d)", tip)
+	}
+	if _, err := blockchain.GetBlockHash(height); err != nil {
+		return 0, fmt.Errorf("error getting block hash: %v", err)
+	}
+	return height, nil
+}
+
+// updateConfirmations recomputes confirmations against the chain tip and
+// announces deposits that just became spendable. When catchingUp, those
+// deposits are flagged silently and a single caught_up event is announced
+// instead, so a fresh tracker does not flood consumers with history.
+func updateConfirmations(db *database.DB, bus *events.Bus, tipHeight int64, catchingUp bool) error {
+	if err := db.UpdateConfirmations(tipHeight); err != nil {
+		return err
+	}
+	spendable, err := db.MarkSpendableTransactions(!catchingUp)
+	if err != nil {
+		return err
+	}
+	for _, tx := range spendable {
+		bus.Publish(events.Event{Type: events.TxConfirmed, Address: tx.Address, TxHash: tx.TxHash, Amount: tx.Amount, Height: tx.BlockHeight})
+	}
+	if catchingUp {
+		log.Printf("Caught up to block %d, suppressed %d spendable notifications", tipHeight, len(spendable))
+		bus.Publish(events.Event{Type: events.CaughtUp, Height: tipHeight, Suppressed: len(spendable)})
+		return db.QueueWebhookEvent(database.WebhookEvent{
+			Type:        notify.EventCaughtUp,
+			BlockHeight: tipHeight,
+			Suppressed:  len(spendable),
+		})
+	}
+	for _, tx := range spendable {
+		log.Printf("Transaction spendable: %s, amount: %s DOGE, address: %s, confirmations: %d", tx.TxHash, tx.Amount, tx.Address, tx.Confirmations)
+	}
+	return nil
+}
+
+// archiveTransactions periodically moves deeply confirmed, fully spent
+// transactions to the archive table to keep the hot table small
+func archiveTransactions(ctx context.Context, db *database.DB, minConfirmations int64, leading func() bool) {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if leading != nil && !leading() {
 				continue
 			}
-			err = db.UpdateAddressBalance(addr, balance)
+			moved, err := db.ArchiveTransactions(minConfirmations)
 			if err != nil {
-				log.Printf("Error updating balance for address %s: %v", addr, err)
+				log.Printf("Error archiving transactions: %v", err)
 				continue
 			}
+			if moved > 0 {
+				log.Printf("Archived %d transactions", moved)
+			}
 		}
 	}
+}
 
-	// Save processed block
-	err = db.SaveProcessedBlock(height, hash)
+// runVerify prints a database integrity report and returns the exit code
+func runVerify(db *database.DB, repair bool) int {
+	issues, err := db.Verify(repair)
 	if err != nil {
-		return fmt.Errorf("error saving processed block: %v", err)
+		log.Printf("Error verifying database: %v", err)
+		return 1
 	}
-
-	return nil
+	if len(issues) == 0 {
+		fmt.Println("Database OK: no integrity issues found")
+		return 0
+	}
+	unrepaired := 0
+	for _, issue := range issues {
+		status := "NOT REPAIRED"
+		if issue.Repaired {
+			status = "repaired"
+		} else if !repair {
+			status = "found"
+		}
+		if !issue.Repaired {
+			unrepaired++
+		}
+		fmt.Printf("%6d %s (%s)\n", issue.Count, issue.Check, status)
+	}
+	if unrepaired > 0 {
+		return 1
+	}
+	return 0
 }
 
 func main() {
+	// "verify" subcommand: check database integrity and exit
+	verify := len(os.Args) > 1 && os.Args[1] == "verify"
+	if verify {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	repair := flag.Bool("repair", false, "With the verify subcommand: fix the integrity issues that can be fixed")
+
 	// Define command line flags
 	rpcHost := flag.String("rpc-host", "127.0.0.1", "RPC host address")
 	rpcPort := flag.Int("rpc-port", 22555, "RPC port number")
 	rpcUser := flag.String("rpc-user", "dogecoin", "RPC username")
 	rpcPass := flag.String("rpc-pass", "dogecoin", "RPC password")
+	rpcBreakerThreshold := flag.Int("rpc-breaker-threshold", 5, "Consecutive node RPC failures that open the circuit breaker (0 disables)")
+	rpcBreakerCooldown := flag.Duration("rpc-breaker-cooldown", 30*time.Second, "How long the open circuit breaker fails node RPC calls fast before probing the node")
+	noZMQ := flag.Bool("no-zmq", false, "Don't subscribe to the node's ZMQ notifications; only poll for new blocks")
+	pollInterval := flag.Duration("poll-interval", defaultPollInterval, "How often to poll the node for new blocks")
+	readOnly := flag.Bool("read-only", false, "Start in read-only mode: serve the API but write nothing to the database until switched off with POST /api/read-only")
+	verifyPoW := flag.Bool("verify-pow", false, "Fetch each block raw and check its Scrypt proof of work before processing it (costs CPU and node bandwidth)")
 	zmqHost := flag.String("zmq-host", "127.0.0.1", "ZMQ host address")
 	zmqPort := flag.Int("zmq-port", 28332, "ZMQ port number")
-	startBlock := flag.Int("start-block", -1, "Block height to start from (default: genesis block)")
+	zmqTopic := flag.String("zmq-topic", core.TopicHashBlock, "ZMQ block topic to subscribe to: hashblock or rawblock")
+	zmqHWM := flag.Int("zmq-hwm", 0, "ZMQ receive high-water mark in messages (0 uses the libzmq default)")
+	zmqReconnect := flag.Duration("zmq-reconnect", 0, "Wait before reconnecting to the node's ZMQ interface (0 uses the libzmq default)")
+	zmqReconnectMax := flag.Duration("zmq-reconnect-max", 0, "Back off ZMQ reconnects up to this interval (0 disables backoff)")
+	startBlock := flag.String("start-block", "", "Block height, hash, or negative offset from the tip (e.g. -1000) to start from (default: resume, or genesis block)")
 
 	// Database flags
 	dbHost := flag.String("db-host", "localhost", "Database host address")
@@ -128,34 +435,113 @@ func main() {
 	dbUser := flag.String("db-user", "postgres", "Database username")
 	dbPass := flag.String("db-pass", "", "Database password")
 	dbName := flag.String("db-name", "dogetracker", "Database name")
+	dbReplicaHost := flag.String("db-replica-host", "", "Read replica host for API read queries (optional, same port and credentials as the primary)")
 
 	// API flags
 	apiPort := flag.Int("api-port", 8080, "API server port")
+	apiUnixSocket := flag.String("api-unix-socket", "", "Serve the API on this Unix domain socket path instead of -api-port")
 	apiToken := flag.String("api-token", "", "API authentication token")
+	apiLog := flag.String("api-log", "errors", "API request logging: none, errors or all")
+	apiJSONCase := flag.String("api-json-case", "snake", "JSON response field names: snake (tx_hash) or camel (txHash)")
+	apiAmountStrings := flag.Bool("api-amounts-as-strings", false, "Return DOGE amounts as decimal strings (\"123.45678901\") instead of JSON numbers")
+	apiMaxBody := flag.Int64("api-max-body", api.DefaultMaxBodySize, "Largest API request body in bytes; larger ones are rejected with 413")
+	apiAdminToken := flag.String("api-admin-token", "", "API token for admin endpoints (admin endpoints are disabled if empty)")
+	maxAddresses := flag.Int("max-addresses", 0, "Maximum number of tracked addresses (0 means unlimited)")
+
+	// Startup flags
+	startupTimeout := flag.Duration("startup-timeout", time.Minute, "How long to keep retrying the database and node connections at startup")
+
+	// Processing flags
+	shards := flag.Int("shards", 1, "Number of address groups processed concurrently within each block")
+	leaderElection := flag.Bool("leader-election", false, "Only process blocks while holding the database leader lock, so redundant instances can share a database")
+	var dustThreshold spec.Amount
+	flag.Var(&dustThreshold, "dust-threshold", "Flag incoming outputs below this many `DOGE` as dust (0 disables)")
+	trustedChange := flag.Bool("trusted-change", false, "Count change paid back to an address by its own spends as spendable without waiting for required_confirmations")
+
+	// Storage flags
+	archiveAfter := flag.Int64("archive-after-confs", 0, "Move spent transactions with more confirmations than this to archived_transactions (0 disables)")
+
+	// Notification flags
+	webhookURL := flag.String("webhook-url", "", "URL to POST tracker events to (optional)")
+	webhookBatchSize := flag.Int("webhook-batch-size", 1, "Send up to this many webhook events per POST, as a JSON array (1 sends each event as an object)")
+	webhookBatchLinger := flag.Duration("webhook-batch-linger", time.Second, "With -webhook-batch-size, how long to wait for a batch to fill before sending it")
+	webhookTimeout := flag.Duration("webhook-timeout", notify.DefaultWebhookTimeout, "Timeout for each webhook delivery attempt")
+	webhookRetryDelay := flag.Duration("webhook-retry-delay", 10*time.Second, "Wait before retrying a failed webhook delivery, doubling on each further failure")
+	webhookRetryMax := flag.Duration("webhook-retry-max-delay", 5*time.Minute, "Longest wait between webhook delivery retries")
+	webhookMaxAttempts := flag.Int("webhook-max-attempts", 0, "Dead-letter a webhook event after this many failed deliveries (0 retries forever)")
+	utxoAlertThreshold := flag.Int("utxo-alert-threshold", 0, "Send a utxo_threshold webhook event when an address's unspent output count reaches this (0 disables)")
+	catchUpBlocks := flag.Int64("catchup-blocks", 1000, "A pass starting more than this many blocks behind the tip is a catch-up: spendable notifications are replaced by one caught_up event (0 disables)")
+	catchUpDefer := flag.Bool("catchup-defer-balances", false, "During a catch-up, recompute address balances once at the end instead of after every transaction")
 
 	// Parse command line flags
 	flag.Parse()
 
 	config := Config{
-		rpcHost:  *rpcHost,
-		rpcPort:  *rpcPort,
-		rpcUser:  *rpcUser,
-		rpcPass:  *rpcPass,
-		zmqHost:  *zmqHost,
-		zmqPort:  *zmqPort,
-		dbHost:   *dbHost,
-		dbPort:   *dbPort,
-		dbUser:   *dbUser,
-		dbPass:   *dbPass,
-		dbName:   *dbName,
-		apiPort:  *apiPort,
-		apiToken: *apiToken,
+		rpcHost:   *rpcHost,
+		rpcPort:   *rpcPort,
+		rpcUser:   *rpcUser,
+		rpcPass:   *rpcPass,
+		breakerN:  *rpcBreakerThreshold,
+		breakerT:  *rpcBreakerCooldown,
+		zmqHost:   *zmqHost,
+		zmqPort:   *zmqPort,
+		noZMQ:     *noZMQ,
+		poll:      *pollInterval,
+		verifyPoW: *verifyPoW,
+		readOnly:  *readOnly,
+		zmqOpts: core.ZMQOptions{
+			Topic:                *zmqTopic,
+			HighWaterMark:        *zmqHWM,
+			ReconnectInterval:    *zmqReconnect,
+			ReconnectIntervalMax: *zmqReconnectMax,
+		},
+		dbHost:    *dbHost,
+		dbPort:    *dbPort,
+		dbUser:    *dbUser,
+		dbPass:    *dbPass,
+		dbName:    *dbName,
+		dbReplica: *dbReplicaHost,
+		apiPort:   *apiPort,
+		apiSocket: *apiUnixSocket,
+		apiToken:  *apiToken,
+		apiLog:    *apiLog,
+		apiCase:   *apiJSONCase,
+		apiAmtStr: *apiAmountStrings,
+		apiAdmin:  *apiAdminToken,
+		maxAddrs:  *maxAddresses,
+		maxBody:   *apiMaxBody,
+		webhook:   *webhookURL,
+		utxoAlert: *utxoAlertThreshold,
+		hookWait:  *webhookTimeout,
+		hookRetry: webhookRetry{
+			delay:       *webhookRetryDelay,
+			maxDelay:    *webhookRetryMax,
+			maxAttempts: *webhookMaxAttempts,
+		},
+		hookBatch: webhookBatching{
+			size:   *webhookBatchSize,
+			linger: *webhookBatchLinger,
+		},
+		catchUp:  *catchUpBlocks,
+		deferBal: *catchUpDefer,
+		archive:  *archiveAfter,
+		dust:     dustThreshold,
+		trusted:  *trustedChange,
+		shards:   *shards,
+		leader:   *leaderElection,
+		wait:     *startupTimeout,
 	}
 
+	log.Printf("Starting %s", version.String())
+
 	ctx, shutdown := context.WithCancel(context.Background())
 
 	// Initialize database
-	db, err := database.NewDB(config.dbHost, config.dbPort, config.dbUser, config.dbPass, config.dbName)
+	var db *database.DB
+	err := waitFor("database", config.wait, func() (err error) {
+		db, err = database.NewDB(config.dbHost, config.dbPort, config.dbUser, config.dbPass, config.dbName)
+		return err
+	})
 	if err != nil {
 		log.Printf("Error connecting to database: %v", err)
 		os.Exit(1)
@@ -168,66 +554,170 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Start API server
+	if verify {
+		os.Exit(runVerify(db, *repair))
+	}
+	db.SetDustThreshold(config.dust)
+	db.SetTrustedChange(config.trusted)
+	db.SetUTXOAlertThreshold(config.utxoAlert)
+
+	// Warn about misconfigured addresses (treated as 1 confirmation)
+	invalid, err := db.GetAddressesWithInvalidConfirmations()
+	if err != nil {
+		log.Printf("Error checking required confirmations: %v", err)
+	}
+	for _, c := range invalid {
+		log.Printf("Warning: address %s has required_confirmations %d, using 1", c.Address, c.RequiredConfirmations)
+	}
+
+	// Configure API server
 	apiServer := api.NewServer(db, config.apiPort, config.apiToken)
-	go func() {
-		if err := apiServer.Start(); err != nil {
-			log.Printf("Error starting API server: %v", err)
+	logLevel, ok := api.ParseLogLevel(config.apiLog)
+	if !ok {
+		log.Printf("Invalid -api-log value: %s", config.apiLog)
+		os.Exit(1)
+	}
+	apiServer.SetLogLevel(logLevel)
+	jsonCase, ok := api.ParseJSONCase(config.apiCase)
+	if !ok {
+		log.Printf("Invalid -api-json-case value: %s", config.apiCase)
+		os.Exit(1)
+	}
+	apiServer.SetJSONCase(jsonCase)
+	apiServer.SetAmountsAsStrings(config.apiAmtStr)
+	apiServer.SetAdminToken(config.apiAdmin)
+	apiServer.SetMaxAddresses(config.maxAddrs)
+	apiServer.SetMaxBodySize(config.maxBody)
+	if config.dbReplica != "" {
+		replica, err := database.NewDB(config.dbReplica, config.dbPort, config.dbUser, config.dbPass, config.dbName)
+		if err != nil {
+			log.Printf("Error connecting to read replica: %v", err)
 			os.Exit(1)
 		}
-	}()
+		defer replica.Close()
+		apiServer.SetReadReplica(replica)
+	}
 
-	// Core Node blockchain access.
-	blockchain := core.NewCoreRPCClient(config.rpcHost, config.rpcPort, config.rpcUser, config.rpcPass)
+	// Bind the API port now, so a conflict fails startup
+	if config.apiSocket != "" {
+		apiServer.SetUnixSocket(config.apiSocket)
+	}
+	if err := apiServer.Listen(); err != nil {
+		log.Printf("Error starting API server: %v", err)
+		os.Exit(1)
+	}
+
+	// Event notifications (webhook/stream)
+	notifier := notify.NewNotifier(config.webhook, config.hookWait)
+	db.SetWebhookOutbox(notifier.WebhookEnabled())
+
+	// Core Node blockchain access, behind a circuit breaker that stops
+	// hammering the node while it is in distress.
+	var breaker *core.CircuitBreaker
+	if config.breakerN > 0 {
+		breaker = core.NewCircuitBreaker(config.breakerN, config.breakerT)
+		apiServer.SetRPCBreaker(breaker)
+	}
+	blockchain := core.NewCoreRPCClient(config.rpcHost, config.rpcPort, config.rpcUser, config.rpcPass, breaker)
+	err = waitFor("Dogecoin node", config.wait, func() error {
+		_, err := blockchain.GetBlockCount()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error connecting to Dogecoin node: %v", err)
+		os.Exit(1)
+	}
 
 	// Check for last processed block if start-block is not specified
-	if *startBlock < 0 {
+	var startHeight int64
+	if *startBlock == "" {
 		lastBlock, err := db.GetLastProcessedBlock()
 		if err != nil {
 			log.Printf("Error getting last processed block: %v", err)
 			os.Exit(1)
 		}
 		if lastBlock != nil {
-			*startBlock = int(lastBlock.Height) + 1
-			log.Printf("Resuming from last processed block height: %d", *startBlock)
+			startHeight = lastBlock.Height + 1
+			log.Printf("Resuming from last processed block height: %d", startHeight)
 		}
+	} else {
+		startHeight, err = resolveStartBlock(blockchain, *startBlock)
+		if err != nil {
+			log.Printf("Invalid -start-block %q: %v", *startBlock, err)
+			os.Exit(1)
+		}
+		log.Printf("Starting from block height: %d", startHeight)
+	}
+
+	// Process blocks in a separate goroutine
+	processor := NewBlockProcessor(db, blockchain, startHeight)
+
+	// Internal events, counted for /api/metrics
+	processor.bus = events.NewBus()
+	eventCounter := events.NewCounter()
+	go eventCounter.Run(ctx, processor.bus.Subscribe(eventBuffer))
+	apiServer.SetEventMetrics(eventCounter)
+	if config.poll > 0 {
+		processor.pollInterval = config.poll
+	}
+	if config.verifyPoW {
+		processor.pow = blockchain
 	}
 
 	// Set up ZMQ listener for new blocks (but don't wait for it)
-	zmqTip, err := core.CoreZMQListener(ctx, config.zmqHost, config.zmqPort)
-	if err != nil {
-		log.Printf("CoreZMQListener: %v", err)
-		os.Exit(1)
+	if config.noZMQ {
+		log.Printf("ZMQ disabled, polling for new blocks every %v", processor.pollInterval)
+	} else {
+		zmqTip, err := core.CoreZMQListener(ctx, config.zmqHost, config.zmqPort, config.zmqOpts)
+		if err != nil {
+			log.Printf("CoreZMQListener: %v", err)
+			os.Exit(1)
+		}
+		processor.tips = chaser.NewTipChaser(ctx, zmqTip, blockchain).Listen(1, true)
+	}
+	processor.shards = config.shards
+	processor.catchUpBlocks = config.catchUp
+	processor.deferBalances = config.deferBal
+	var leading func() bool
+	if config.leader {
+		lock := db.NewLeaderLock()
+		go lock.Run(ctx, leaderInterval)
+		leading = lock.IsLeader
+		processor.leading = leading
+		processor.resume = *startBlock == ""
+		apiServer.SetLeaderStatus(lock)
 	}
-	_ = chaser.NewTipChaser(ctx, zmqTip, blockchain).Listen(1, true)
+	apiServer.SetBlockCursor(processor)
+	apiServer.SetRescanner(processor)
+	apiServer.SetBlockReprocessor(processor)
+	apiServer.SetMerkleProver(blockchain)
+	apiServer.SetSyncStatus(processor)
+	apiServer.SetReadOnlyMode(processor)
+	processor.SetReadOnly(config.readOnly)
+	processor.confirmationsUpdated = apiServer.ConfirmationsUpdated
+	go processor.Run(ctx)
 
-	// Process blocks in a separate goroutine
-	go func() {
-		currentHeight := int64(*startBlock)
-		ticker := time.NewTicker(5 * time.Second) // Check for new blocks every 5 seconds
-		defer ticker.Stop()
+	// Background writers run on the leader, and not in read-only mode
+	writing := func() bool {
+		return !processor.ReadOnly() && (leading == nil || leading())
+	}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				// Get current block height
-				blockCount, err := blockchain.GetBlockCount()
-				if err != nil {
-					log.Printf("Error getting block count: %v", err)
-					continue
-				}
+	// Archive deeply confirmed, fully spent transactions
+	if config.archive > 0 {
+		go archiveTransactions(ctx, db, config.archive, writing)
+	}
 
-				// Process all blocks up to the current height
-				for height := currentHeight; height <= blockCount; height++ {
-					if err := processBlock(ctx, db, blockchain, height); err != nil {
-						log.Printf("Error processing block %d: %v", height, err)
-						continue
-					}
-					currentHeight = height + 1
-				}
-			}
+	// Deliver queued webhook events
+	if notifier.WebhookEnabled() {
+		apiServer.SetWebhookMetrics(notifier)
+		go deliverWebhooks(ctx, db, notifier, config.hookRetry, config.hookBatch, writing)
+	}
+
+	// Start API server
+	go func() {
+		if err := apiServer.Start(); err != nil {
+			log.Printf("Error starting API server: %v", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -249,4 +739,7 @@ func main() {
 
 	// Wait for shutdown.
 	<-ctx.Done()
+	if err := apiServer.Close(); err != nil {
+		log.Printf("Error closing API server: %v", err)
+	}
 }
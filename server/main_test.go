@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+func TestConfirmationsFromTip(t *testing.T) {
+	tests := []struct {
+		name        string
+		height, tip int64
+		want        int
+	}{
+		{"tip block", 5000000, 5000000, 1},
+		{"one below the tip", 4999999, 5000000, 2},
+		{"old block during a catch-up", 4000000, 5000000, 1000001},
+		{"genesis", 0, 5000000, 5000001},
+		{"above a stale tip", 5000001, 5000000, 1},
+	}
+	for _, tt := range tests {
+		if got := confirmationsFromTip(tt.height, tt.tip); got != tt.want {
+			t.Errorf("%s: confirmationsFromTip(%d, %d) = %d, want %d", tt.name, tt.height, tt.tip, got, tt.want)
+		}
+	}
+}
+
+func TestAlreadyProcessed(t *testing.T) {
+	const hash, other = "00000000000000aa", "00000000000000bb"
+
+	// The same block fed twice: processed the first time, skipped the second
+	var last *database.ProcessedBlock
+	deliveries := []struct {
+		height int64
+		hash   string
+		want   bool
+	}{
+		{100, hash, false},
+		{100, hash, true},
+		{101, other, false},
+		{101, other, true},
+		{101, hash, false}, // another block at the height, after a rewind
+	}
+	for i, d := range deliveries {
+		if got := alreadyProcessed(last, d.height, d.hash); got != d.want {
+			t.Errorf("delivery %d of block %d (%s): alreadyProcessed = %v, want %v", i, d.height, d.hash, got, d.want)
+		}
+		if !d.want {
+			last = &database.ProcessedBlock{Height: d.height, Hash: d.hash}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/notify"
+)
+
+const (
+	outboxInterval  = time.Second // how often to look for new webhook events
+	outboxBatchSize = 100
+)
+
+// webhookRetry is the retry schedule for failed webhook deliveries: the
+// first retry waits delay, each further one twice as long, up to maxDelay.
+// An event that failed maxAttempts times (if positive) is dead-lettered.
+type webhookRetry struct {
+	delay       time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+}
+
+// backoff returns the wait after the given number of consecutive failures
+func (r webhookRetry) backoff(failures int) time.Duration {
+	wait := r.delay
+	for i := 1; i < failures && wait < r.maxDelay; i++ {
+		wait *= 2
+	}
+	if r.maxDelay > 0 && wait > r.maxDelay {
+		wait = r.maxDelay
+	}
+	return wait
+}
+
+// webhookBatching coalesces webhook events into one POST with a JSON array
+// body of up to size events, waiting up to linger after the oldest one for
+// a batch to fill. A size of 1 or less sends each event on its own, as a
+// JSON object.
+type webhookBatching struct {
+	size   int
+	linger time.Duration
+}
+
+// outboxWorker delivers the events queued in webhook_outbox
+type outboxWorker struct {
+	db       *database.DB
+	notifier *notify.Notifier
+	retry    webhookRetry
+	batch    webhookBatching
+
+	// Oldest pending event of a batch that is not full yet, and when it
+	// was first seen, to know when its linger time is over
+	headID    int64
+	headSince time.Time
+}
+
+// deliverWebhooks sends the events queued in webhook_outbox to the webhook,
+// oldest first, marking each delivered once the webhook accepts it. A failed
+// delivery is retried (on the retry schedule) before any later event is
+// sent, so events for an address always arrive in order, until it is
+// dead-lettered. An event may be delivered more than once if the tracker
+// stops between sending it and marking it delivered.
+func deliverWebhooks(ctx context.Context, db *database.DB, notifier *notify.Notifier, retry webhookRetry, batch webhookBatching, leading func() bool) {
+	worker := &outboxWorker{db: db, notifier: notifier, retry: retry, batch: batch}
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if leading != nil && !leading() {
+				continue
+			}
+			if worker.deliverPending(ctx) {
+				failures = 0
+				continue
+			}
+			failures++
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry.backoff(failures)):
+			}
+		}
+	}
+}
+
+// deliverPending delivers pending events until none are left (or only a
+// batch still lingering) or a delivery fails. Returns false if one failed.
+func (w *outboxWorker) deliverPending(ctx context.Context) bool {
+	size := w.batch.size
+	if size < 1 {
+		size = 1
+	}
+	limit := outboxBatchSize
+	if size > limit {
+		limit = size
+	}
+	for ctx.Err() == nil {
+		events, err := w.db.PendingWebhookEvents(limit)
+		if err != nil {
+			log.Printf("Error getting webhook events: %v", err)
+			return false
+		}
+		if len(events) == 0 {
+			return true
+		}
+		// A full page may have more events behind it, so its trailing
+		// partial batch is fetched again with them instead
+		fullPage := len(events) == limit
+		for len(events) > 0 {
+			n := size
+			if n > len(events) {
+				n = len(events)
+			}
+			chunk := events[:n]
+			events = events[n:]
+
+			if n < size {
+				if fullPage {
+					break
+				}
+				// Give a partial batch its linger time to fill up
+				if w.lingering(chunk[0].ID) {
+					return true
+				}
+			}
+			if !w.deliver(chunk, size > 1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lingering reports whether the batch starting at event id is still
+// waiting for more events
+func (w *outboxWorker) lingering(id int64) bool {
+	if id != w.headID {
+		w.headID = id
+		w.headSince = time.Now()
+	}
+	return time.Since(w.headSince) < w.batch.linger
+}
+
+// deliver sends events, as an array if batched, and marks them delivered.
+// On failure each event's attempt is recorded; returns true anyway if that
+// dead-lettered them all, so later events go out.
+func (w *outboxWorker) deliver(events []database.WebhookEvent, batched bool) bool {
+	payload := make([]notify.Event, len(events))
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		payload[i] = notify.Event{
+			Type:          e.Type,
+			Address:       e.Address,
+			TxHash:        e.TxHash,
+			Amount:        e.Amount,
+			BlockHeight:   e.BlockHeight,
+			Confirmations: e.Confirmations,
+			Suppressed:    e.Suppressed,
+			UTXOCount:     e.UTXOCount,
+			Replay:        e.Replay,
+			Time:          e.CreatedAt.UTC(),
+		}
+		ids[i] = e.ID
+	}
+
+	var err error
+	if batched {
+		err = w.notifier.DeliverBatch(payload)
+	} else {
+		err = w.notifier.Deliver(payload[0])
+	}
+	if err != nil {
+		allDead := true
+		for _, e := range events {
+			log.Printf("Notifier: webhook delivery failed for %s event %s (attempt %d): %v", e.Type, e.TxHash, e.Attempts+1, err)
+			dead, ferr := w.db.RecordWebhookFailure(e.ID, err.Error(), w.retry.maxAttempts)
+			if ferr != nil {
+				log.Printf("Error recording webhook failure for event %d: %v", e.ID, ferr)
+			}
+			if dead {
+				log.Printf("Notifier: %s event %d dead-lettered after %d attempts", e.Type, e.ID, e.Attempts+1)
+			} else {
+				allDead = false
+			}
+		}
+		return allDead
+	}
+	if err := w.db.MarkWebhookDelivered(ids...); err != nil {
+		log.Printf("Error marking webhook events delivered: %v", err)
+		return false
+	}
+	return true
+}
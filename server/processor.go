@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/events"
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+const defaultPollInterval = 5 * time.Second // check for new blocks every 5 seconds
+
+/*
+ * BlockProcessor walks the chain from its cursor up to the tip.
+ *
+ * Requests that move the cursor (Rewind), an address's history (Rescan) or
+ * one block's records (Reprocess) are executed on the processing goroutine
+ * between blocks, so they never race with block processing.
+ */
+type BlockProcessor struct {
+	db            *database.DB
+	blockchain    spec.Blockchain
+	bus           *events.Bus // internal events (optional)
+	currentHeight int64
+	tipHeight     int64 // chain tip at the start of the latest pass
+	rewind        chan rewindRequest
+	rescan        chan rescanRequest
+	reprocess     chan reprocessRequest
+	shards        int // address groups processed concurrently per block
+
+	// The node is polled for new blocks every pollInterval; tips (from ZMQ,
+	// nil without it) starts a pass as soon as a new block is announced.
+	pollInterval time.Duration
+	tips         <-chan string
+
+	// With -verify-pow, each block's proof of work is checked before it is
+	// processed; a block that fails stops processing until it passes.
+	pow powVerifier
+
+	// A pass that starts more than catchUpBlocks behind the tip starts a
+	// catch-up: its spendable notifications are replaced by one caught_up
+	// event. 0 disables suppression.
+	catchUpBlocks int64
+	catchingUp    atomic.Bool
+
+	// While readOnly, nothing is written to the database: no blocks are
+	// processed and rewinds, rescans and reprocessing are refused. The tip
+	// is still followed, so processing resumes from the cursor once it is
+	// switched off.
+	readOnly atomic.Bool
+
+	// With deferBalances, stored balances are not updated during a catch-up
+	// but recomputed once at its end (and once at startup, in case a
+	// previous run stopped mid catch-up).
+	deferBalances     bool
+	balancesRefreshed bool
+
+	rescanMu sync.Mutex
+	rescans  map[string]*rescanJob // by address, including finished ones
+
+	// With leader election, only the leader processes blocks. leading is nil
+	// when election is off. On taking over, the cursor is reloaded from the
+	// database (unless this is the first term and -start-block was given).
+	leading   func() bool
+	wasLeader bool
+	resume    bool
+
+	confirmationsUpdated func() // called after each confirmation pass (optional)
+}
+
+// powVerifier checks a block's proof of work against the node's copy of it
+type powVerifier interface {
+	VerifyBlockPoW(hash string) error
+}
+
+type rewindRequest struct {
+	height int64
+	result chan error
+}
+
+func NewBlockProcessor(db *database.DB, blockchain spec.Blockchain, startHeight int64) *BlockProcessor {
+	return &BlockProcessor{
+		db:            db,
+		blockchain:    blockchain,
+		currentHeight: startHeight,
+		pollInterval:  defaultPollInterval,
+		rewind:        make(chan rewindRequest),
+		rescan:        make(chan rescanRequest),
+		reprocess:     make(chan reprocessRequest),
+		rescans:       make(map[string]*rescanJob),
+	}
+}
+
+// Run processes blocks until ctx is cancelled.
+func (p *BlockProcessor) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	ready := make(chan struct{})
+	close(ready)
+
+	for {
+		// Scan rescan blocks whenever there is nothing else to do
+		var rescanWork <-chan struct{}
+		if p.lead() && !p.readOnly.Load() && len(p.rescanning()) > 0 {
+			rescanWork = ready
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-p.rewind:
+			req.result <- p.rewindTo(req.height)
+		case req := <-p.rescan:
+			req.result <- p.startRescan(req.address, req.fromHeight)
+		case req := <-p.reprocess:
+			report, err := p.reprocessBlock(req.hash)
+			req.result <- reprocessResult{report: report, err: err}
+		case <-ticker.C:
+			if p.lead() {
+				p.catchUp(ctx)
+			}
+		case <-p.tips:
+			if p.lead() {
+				p.catchUp(ctx)
+			}
+		case <-rescanWork:
+			p.rescanStep()
+		}
+	}
+}
+
+func (p *BlockProcessor) catchUp(ctx context.Context) {
+	// Get current block height
+	blockCount, err := p.blockchain.GetBlockCount()
+	if err != nil {
+		log.Printf("Error getting block count: %v", err)
+		return
+	}
+
+	p.tipHeight = blockCount
+	if p.readOnly.Load() {
+		return
+	}
+	if p.deferBalances && !p.balancesRefreshed {
+		if err := p.db.RefreshAllBalances(); err != nil {
+			log.Printf("Error recomputing balances: %v", err)
+			return
+		}
+		p.balancesRefreshed = true
+	}
+
+	// Process all blocks up to the current height
+	// (a catch-up interrupted by an error stays one until a pass completes)
+	behind := blockCount - p.currentHeight + 1
+	catchingUp := p.catchingUp.Load()
+	if !catchingUp && p.catchUpBlocks > 0 && behind > p.catchUpBlocks {
+		catchingUp = true
+		p.catchingUp.Store(true)
+		log.Printf("Catching up %d blocks, spendable notifications are suppressed until done", behind)
+	}
+	for height := p.currentHeight; height <= blockCount; height++ {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-p.rewind:
+			// Cursor moved: stop this pass, the next tick continues from there
+			req.result <- p.rewindTo(req.height)
+			return
+		case req := <-p.rescan:
+			req.result <- p.startRescan(req.address, req.fromHeight)
+		case req := <-p.reprocess:
+			report, err := p.reprocessBlock(req.hash)
+			req.result <- reprocessResult{report: report, err: err}
+		default:
+		}
+		if !p.lead() || p.readOnly.Load() {
+			return
+		}
+		p.rescanStep()
+		if err := p.verifyPoW(height); err != nil {
+			log.Printf("Error verifying block %d: %v", height, err)
+			return
+		}
+		if err := processBlock(ctx, p.db, p.blockchain, p.bus, height, blockCount, p.shards, p.rescanning(), catchingUp && p.deferBalances); err != nil {
+			// Stop this pass rather than skip the block; the next tick retries it
+			// (and while the node's circuit breaker is open, fails fast).
+			log.Printf("Error processing block %d: %v", height, err)
+			return
+		}
+		p.currentHeight = height + 1
+	}
+
+	// Refresh confirmations against the new tip
+	if catchingUp && p.deferBalances {
+		if err := p.db.RefreshAllBalances(); err != nil {
+			log.Printf("Error recomputing balances: %v", err)
+			return
+		}
+	}
+	if err := updateConfirmations(p.db, p.bus, blockCount, catchingUp); err != nil {
+		log.Printf("Error updating confirmations: %v", err)
+		return
+	}
+	p.catchingUp.Store(false)
+	if p.confirmationsUpdated != nil {
+		p.confirmationsUpdated()
+	}
+}
+
+// CatchingUp reports whether the processor is catching up from far behind
+// the tip rather than following it.
+func (p *BlockProcessor) CatchingUp() bool {
+	return p.catchingUp.Load()
+}
+
+// BalancesDeferred reports whether stored balances are being left for a
+// recompute at the end of the catch-up.
+func (p *BlockProcessor) BalancesDeferred() bool {
+	return p.deferBalances && p.catchingUp.Load()
+}
+
+// ReadOnly reports whether database writes are paused.
+func (p *BlockProcessor) ReadOnly() bool {
+	return p.readOnly.Load()
+}
+
+// SetReadOnly pauses or resumes database writes. A block being processed
+// is finished first.
+func (p *BlockProcessor) SetReadOnly(readOnly bool) {
+	if p.readOnly.Swap(readOnly) != readOnly {
+		if readOnly {
+			log.Printf("Read-only mode on: block processing is paused")
+		} else {
+			log.Printf("Read-only mode off: block processing resumes")
+		}
+	}
+}
+
+// Rewind moves the cursor back so that every block above height is
+// processed again. Blocks until the processing goroutine has applied it.
+func (p *BlockProcessor) Rewind(height int64) error {
+	result := make(chan error, 1)
+	p.rewind <- rewindRequest{height: height, result: result}
+	return <-result
+}
+
+// lead reports whether this instance should process blocks, reloading the
+// cursor when it has just become the leader.
+func (p *BlockProcessor) lead() bool {
+	if p.leading == nil {
+		return true
+	}
+	if !p.leading() {
+		p.wasLeader = false
+		return false
+	}
+	if !p.wasLeader {
+		p.wasLeader = true
+		if p.resume {
+			block, err := p.db.GetLastProcessedBlock()
+			if err != nil {
+				log.Printf("Error getting last processed block: %v", err)
+			} else if block != nil {
+				p.currentHeight = block.Height + 1
+			}
+		}
+		p.resume = true
+		log.Printf("Leading: processing blocks from height %d", p.currentHeight)
+	}
+	return true
+}
+
+func (p *BlockProcessor) rewindTo(height int64) error {
+	if !p.lead() {
+		return fmt.Errorf("this instance is a standby, rewind on the leader")
+	}
+	if p.readOnly.Load() {
+		return fmt.Errorf("read-only mode, rewind is not allowed")
+	}
+	if height < 0 || height >= p.currentHeight {
+		return fmt.Errorf("cannot rewind to height %d (next block to process is %d)", height, p.currentHeight)
+	}
+	hash, err := p.blockchain.GetBlockHash(height)
+	if err != nil {
+		return fmt.Errorf("error getting block hash: %v", err)
+	}
+	if err := p.db.RewindProcessedBlocks(height, hash); err != nil {
+		return err
+	}
+	log.Printf("Rewound block cursor to height %d (%s), reprocessing from %d", height, hash, height+1)
+	p.bus.Publish(events.Event{Type: events.Reorg, Height: height})
+	p.currentHeight = height + 1
+	p.rewindRescans(height)
+	return nil
+}
+
+// verifyPoW checks the proof of work of the block at height, if enabled
+func (p *BlockProcessor) verifyPoW(height int64) error {
+	if p.pow == nil {
+		return nil
+	}
+	hash, err := p.blockchain.GetBlockHash(height)
+	if err != nil {
+		return fmt.Errorf("error getting block hash: %v", err)
+	}
+	return p.pow.VerifyBlockPoW(hash)
+}
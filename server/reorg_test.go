@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/database"
+	"github.com/dogeorg/dogetracker/pkg/spec"
+)
+
+const doge = spec.KoinuPerDoge
+
+// testDB returns a database with the tracker's schema, created in a
+// Postgres schema of its own that is dropped when the test ends. The
+// server is given as a lib/pq connection string in DOGETRACKER_TEST_DB;
+// without it the test is skipped.
+func testDB(t *testing.T) *database.DB {
+	t.Helper()
+	dsn := os.Getenv("DOGETRACKER_TEST_DB")
+	if dsn == "" {
+		t.Skip("DOGETRACKER_TEST_DB is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("dogetracker_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	var scoped string
+	switch {
+	case !strings.Contains(dsn, "://"):
+		scoped = dsn + " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		scoped = dsn + "&search_path=" + schema
+	default:
+		scoped = dsn + "?search_path=" + schema
+	}
+	conn, err := sql.Open("postgres", scoped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	db := &database.DB{DB: conn}
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// fakeChain is a node whose main chain can be reorganized. Blocks replaced
+// by a fork are kept, so their headers report them off the main chain.
+type fakeChain struct {
+	main   []*fakeBlock // by height
+	byHash map[string]*fakeBlock
+}
+
+type fakeBlock struct {
+	hash   string
+	height int64
+	txs    map[string][]spec.Transaction // by address
+}
+
+func newFakeChain(blocks int) *fakeChain {
+	c := &fakeChain{byHash: make(map[string]*fakeBlock)}
+	c.reorganize(0, "main", blocks)
+	return c
+}
+
+// reorganize replaces the blocks from height on with the given number of
+// new ones, named after fork
+func (c *fakeChain) reorganize(height int64, fork string, blocks int) {
+	c.main = c.main[:height]
+	for i := 0; i < blocks; i++ {
+		b := &fakeBlock{
+			hash:   fmt.Sprintf("%s-%d", fork, height+int64(i)),
+			height: height + int64(i),
+			txs:    make(map[string][]spec.Transaction),
+		}
+		c.main = append(c.main, b)
+		c.byHash[b.hash] = b
+	}
+}
+
+// pay adds an output to address in the main chain block at height
+func (c *fakeChain) pay(height int64, txid, address string, amount spec.Amount) {
+	b := c.main[height]
+	b.txs[address] = append(b.txs[address], spec.Transaction{Hash: txid, Amount: amount})
+}
+
+// spend adds a spend of address's output txid:0 by spender to the main
+// chain block at height
+func (c *fakeChain) spend(height int64, txid, address, spender string) {
+	b := c.main[height]
+	b.txs[address] = append(b.txs[address], spec.Transaction{Hash: txid, IsSpent: true, SpentBy: spender})
+}
+
+func (c *fakeChain) onMain(b *fakeBlock) bool {
+	return b.height < int64(len(c.main)) && c.main[b.height] == b
+}
+
+func (c *fakeChain) GetBlockHeader(blockHash string) (spec.BlockHeader, error) {
+	b, ok := c.byHash[blockHash]
+	if !ok {
+		return spec.BlockHeader{}, fmt.Errorf("block %s not found", blockHash)
+	}
+	header := spec.BlockHeader{Hash: b.hash, Height: b.height, Confirmations: -1, Time: uint64(1700000000 + 60*b.height)}
+	if c.onMain(b) {
+		header.Confirmations = int64(len(c.main)) - b.height
+	}
+	return header, nil
+}
+
+func (c *fakeChain) GetBlock(blockHash string) (string, error) {
+	return "", fmt.Errorf("not implemented")
+}
+
+func (c *fakeChain) GetBlockHash(blockHeight int64) (string, error) {
+	if blockHeight < 0 || blockHeight >= int64(len(c.main)) {
+		return "", fmt.Errorf("block height %d out of range", blockHeight)
+	}
+	return c.main[blockHeight].hash, nil
+}
+
+func (c *fakeChain) GetBestBlockHash() (string, error) {
+	return c.main[len(c.main)-1].hash, nil
+}
+
+func (c *fakeChain) GetBlockCount() (int64, error) {
+	return int64(len(c.main)) - 1, nil
+}
+
+func (c *fakeChain) GetAddressTransactions(address string, height int64) ([]spec.Transaction, error) {
+	if height < 0 || height >= int64(len(c.main)) {
+		return nil, fmt.Errorf("block height %d out of range", height)
+	}
+	return c.main[height].txs[address], nil
+}
+
+// unspentOutputs returns an address's unspent outputs as "hash@height"
+func unspentOutputs(t *testing.T, db *database.DB, address string) []string {
+	t.Helper()
+	utxos, err := db.GetUnspentOutputs(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, u := range utxos {
+		got = append(got, fmt.Sprintf("%s@%d", u.TxHash, u.BlockHeight))
+	}
+	return got
+}
+
+// A reorg is followed by rewinding the cursor below the fork and processing
+// the new branch: what the old branch recorded is gone (and kept as
+// dropped), outputs it spent are unspent again, and the new branch's
+// blocks can then be reprocessed like any other
+func TestReorgRewindAndReprocess(t *testing.T) {
+	const address = "DTracked"
+	db := testDB(t)
+	if err := db.TrackAddresses([]database.AddressConfig{{Address: address, RequiredConfirmations: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	chain := newFakeChain(4)
+	chain.pay(1, "a1", address, 10*doge)
+	chain.pay(2, "b1", address, 5*doge)
+	chain.spend(3, "a1", address, "s1")
+
+	ctx := context.Background()
+	p := NewBlockProcessor(db, chain, 1)
+	p.catchUp(ctx)
+	if got, want := unspentOutputs(t, db, address), []string{"b1@2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("before the reorg unspent outputs = %v, want %v", got, want)
+	}
+
+	// Blocks 2 and 3 are replaced by a longer fork that pays c1 instead
+	stale := chain.main[2].hash
+	chain.reorganize(2, "fork", 3)
+	chain.pay(3, "c1", address, 7*doge)
+
+	if err := p.rewindTo(1); err != nil {
+		t.Fatal(err)
+	}
+	p.catchUp(ctx)
+
+	if got, want := unspentOutputs(t, db, address), []string{"a1@1", "c1@3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after the reorg unspent outputs = %v, want %v", got, want)
+	}
+	if balance, err := db.GetAddressBalance(address); err != nil || balance != 17*doge {
+		t.Errorf("after the reorg balance = %s, %v, want 17", balance, err)
+	}
+	last, err := db.GetLastProcessedBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.Hash != "fork-4" {
+		t.Errorf("last processed block = %+v, want fork-4", last)
+	}
+	dropped, err := db.GetDroppedTransactions(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	droppedB1 := false
+	for _, d := range dropped {
+		droppedB1 = droppedB1 || d.TxHash == "b1"
+	}
+	if !droppedB1 {
+		t.Errorf("dropped transactions = %+v, want b1 among them", dropped)
+	}
+
+	// The old branch can't be reprocessed; a fork block the node now
+	// reports differently can
+	if _, err := p.reprocessBlock(stale); err == nil {
+		t.Errorf("reprocessing stale block %s succeeded, want an error", stale)
+	}
+	chain.pay(2, "d1", address, 1*doge)
+	report, err := p.reprocessBlock("fork-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Removed != 0 {
+		t.Errorf("reprocess report: %d added, %d removed, want 1 and 0", report.Added, report.Removed)
+	}
+	if got, want := unspentOutputs(t, db, address), []string{"a1@1", "d1@2", "c1@3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after reprocessing unspent outputs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/api"
+	"github.com/dogeorg/dogetracker/pkg/database"
+)
+
+/*
+ * Reprocessing repairs one processed block without moving the cursor: what
+ * is recorded at its height is deleted and the block is walked again for
+ * every tracked address. Like rewinds and rescans it runs on the processing
+ * goroutine, so it never races with block processing.
+ */
+
+type reprocessRequest struct {
+	hash   string
+	result chan reprocessResult
+}
+
+type reprocessResult struct {
+	report api.ReprocessReport
+	err    error
+}
+
+// Reprocess deletes what is recorded for a processed block and processes it
+// again. Blocks until the processing goroutine has done it.
+func (p *BlockProcessor) Reprocess(hash string) (api.ReprocessReport, error) {
+	result := make(chan reprocessResult, 1)
+	p.reprocess <- reprocessRequest{hash: hash, result: result}
+	res := <-result
+	return res.report, res.err
+}
+
+func (p *BlockProcessor) reprocessBlock(hash string) (api.ReprocessReport, error) {
+	report := api.ReprocessReport{Hash: hash}
+	if !p.lead() {
+		return report, fmt.Errorf("this instance is a standby, reprocess on the leader")
+	}
+	if p.readOnly.Load() {
+		return report, fmt.Errorf("read-only mode, reprocess is not allowed")
+	}
+	header, err := p.blockchain.GetBlockHeader(hash)
+	if err != nil {
+		return report, fmt.Errorf("error getting block header: %v", err)
+	}
+	if header.Confirmations < 0 {
+		return report, fmt.Errorf("block %s is not on the main chain", hash)
+	}
+	if header.Height >= p.currentHeight {
+		return report, fmt.Errorf("block %d has not been processed yet (next block to process is %d)", header.Height, p.currentHeight)
+	}
+	report.Height = header.Height
+
+	before, err := p.db.GetBlockAddresses(hash)
+	if err != nil {
+		return report, err
+	}
+	// Addresses being rescanned that have not reached this block yet get to
+	// it on their own; those past it are walked again like the others
+	skip := p.rescansBefore(header.Height)
+	keep := make([]string, 0, len(skip))
+	for addr := range skip {
+		keep = append(keep, addr)
+	}
+	cleared, err := p.db.ClearBlock(header.Height, keep)
+	if err != nil {
+		return report, err
+	}
+
+	tracked, err := p.db.GetTrackedAddresses()
+	if err != nil {
+		return report, fmt.Errorf("error getting tracked addresses: %v", err)
+	}
+	blockTime := time.Unix(int64(header.Time), 0).UTC()
+	var processErr error
+	for _, addr := range tracked {
+		if skip[addr] {
+			continue
+		}
+		if err := processAddress(p.db, p.blockchain, p.bus, addr, header.Height, p.tipHeight, blockTime, false); err != nil {
+			// The block is left partially processed: reprocessing it again repairs it
+			processErr = fmt.Errorf("error reprocessing %s: %v", addr, err)
+			break
+		}
+	}
+	// Even after a failure, so what was recorded again keeps its state
+	if err := p.db.RestoreClearedTransactions(header.Height, cleared); err != nil {
+		return report, err
+	}
+	if processErr != nil {
+		return report, processErr
+	}
+	if err := p.db.RefreshAllBalances(); err != nil {
+		return report, fmt.Errorf("error recomputing balances: %v", err)
+	}
+
+	// Transactions that did not come back are recorded as removed
+	recorded, err := p.db.GetBlockTransactions(header.Height)
+	if err != nil {
+		return report, err
+	}
+	found := make(map[database.BlockTransaction]bool, len(recorded))
+	for _, t := range recorded {
+		found[t] = true
+	}
+	var removed []database.BlockTransaction
+	for _, c := range cleared {
+		t := c.BlockTransaction
+		if !found[t] {
+			removed = append(removed, t)
+		}
+		delete(found, t)
+	}
+	if err := p.db.RecordRemovedTransactions(header.Height, removed, database.RemovedByReprocess); err != nil {
+		return report, err
+	}
+
+	after, err := p.db.GetBlockAddresses(hash)
+	if err != nil {
+		return report, err
+	}
+	report.Removed = len(removed)
+	report.Added = len(found)
+	if before != nil {
+		report.Before = before.Addresses
+	}
+	if after != nil {
+		report.After = after.Addresses
+	}
+	log.Printf("Reprocessed block %d (%s): %d transactions added, %d removed", header.Height, hash, report.Added, report.Removed)
+	return report, nil
+}
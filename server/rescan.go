@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dogeorg/dogetracker/pkg/api"
+)
+
+/*
+ * Address rescans rebuild one address's history without moving the block
+ * cursor. They run on the processing goroutine, one block at a time between
+ * the regular work: while an address is being rescanned, processBlock skips
+ * it, and once the rescan reaches the cursor the address rejoins regular
+ * processing.
+ */
+
+type rescanRequest struct {
+	address    string
+	fromHeight int64
+	result     chan error
+}
+
+type rescanJob struct {
+	status api.RescanStatus
+}
+
+// Rescan starts rebuilding an address's history from fromHeight.
+// Blocks until the processing goroutine has set the rescan up.
+func (p *BlockProcessor) Rescan(address string, fromHeight int64) error {
+	result := make(chan error, 1)
+	p.rescan <- rescanRequest{address: address, fromHeight: fromHeight, result: result}
+	return <-result
+}
+
+// Rescans reports the progress of running and finished rescans.
+func (p *BlockProcessor) Rescans() []api.RescanStatus {
+	p.rescanMu.Lock()
+	defer p.rescanMu.Unlock()
+	statuses := make([]api.RescanStatus, 0, len(p.rescans))
+	for _, job := range p.rescans {
+		statuses = append(statuses, job.status)
+	}
+	return statuses
+}
+
+func (p *BlockProcessor) startRescan(address string, fromHeight int64) error {
+	if !p.lead() {
+		return fmt.Errorf("this instance is a standby, rescan on the leader")
+	}
+	if p.readOnly.Load() {
+		return fmt.Errorf("read-only mode, rescan is not allowed")
+	}
+	if fromHeight < 0 || fromHeight >= p.currentHeight {
+		return fmt.Errorf("cannot rescan from height %d (next block to process is %d)", fromHeight, p.currentHeight)
+	}
+
+	p.rescanMu.Lock()
+	defer p.rescanMu.Unlock()
+	if job, ok := p.rescans[address]; ok && !job.status.Done {
+		return fmt.Errorf("address %s is already being rescanned", address)
+	}
+	if err := p.db.RewindAddress(address, fromHeight-1); err != nil {
+		return err
+	}
+	p.rescans[address] = &rescanJob{status: api.RescanStatus{
+		Address:    address,
+		FromHeight: fromHeight,
+		NextHeight: fromHeight,
+		StartedAt:  time.Now().UTC(),
+	}}
+	log.Printf("Rescanning address %s from height %d", address, fromHeight)
+	return nil
+}
+
+// rescanning returns the addresses with a running rescan, which regular
+// block processing must skip. Rescans that have reached the cursor finish here.
+func (p *BlockProcessor) rescanning() map[string]bool {
+	p.rescanMu.Lock()
+	defer p.rescanMu.Unlock()
+	active := make(map[string]bool)
+	for address, job := range p.rescans {
+		if job.status.Done {
+			continue
+		}
+		if job.status.NextHeight >= p.currentHeight {
+			p.finishRescan(job)
+			continue
+		}
+		active[address] = true
+	}
+	return active
+}
+
+// rescansBefore returns the addresses with a running rescan that has not
+// scanned height yet.
+func (p *BlockProcessor) rescansBefore(height int64) map[string]bool {
+	active := p.rescanning()
+	p.rescanMu.Lock()
+	defer p.rescanMu.Unlock()
+	for address := range active {
+		if p.rescans[address].status.NextHeight > height {
+			delete(active, address)
+		}
+	}
+	return active
+}
+
+// finishRescan marks a job done. Must hold rescanMu.
+func (p *BlockProcessor) finishRescan(job *rescanJob) {
+	now := time.Now().UTC()
+	job.status.Done = true
+	job.status.FinishedAt = &now
+	log.Printf("Finished rescanning address %s from height %d", job.status.Address, job.status.FromHeight)
+}
+
+// rescanStep scans the next block of every running rescan.
+func (p *BlockProcessor) rescanStep() {
+	for address := range p.rescanning() {
+		p.rescanMu.Lock()
+		height := p.rescans[address].status.NextHeight
+		p.rescanMu.Unlock()
+
+		hash, err := p.blockchain.GetBlockHash(height)
+		if err != nil {
+			log.Printf("Error rescanning block %d for %s: %v", height, address, err)
+			continue
+		}
+		header, err := p.blockchain.GetBlockHeader(hash)
+		if err != nil {
+			log.Printf("Error rescanning block %d for %s: %v", height, address, err)
+			continue
+		}
+		if err := processAddress(p.db, p.blockchain, p.bus, address, height, p.tipHeight, time.Unix(int64(header.Time), 0).UTC(), false); err != nil {
+			log.Printf("Error rescanning block %d for %s: %v", height, address, err)
+			continue
+		}
+
+		p.rescanMu.Lock()
+		p.rescans[address].status.NextHeight = height + 1
+		p.rescanMu.Unlock()
+	}
+}
+
+// rewindRescans moves running rescans back after the cursor is rewound to height.
+func (p *BlockProcessor) rewindRescans(height int64) {
+	p.rescanMu.Lock()
+	defer p.rescanMu.Unlock()
+	for _, job := range p.rescans {
+		if !job.status.Done && job.status.NextHeight > height+1 {
+			job.status.NextHeight = height + 1
+		}
+	}
+}